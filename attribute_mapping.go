@@ -0,0 +1,100 @@
+package cssinliner
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AttributeMapping describes how a presentational HTML attribute is converted
+// into a CSS declaration (e.g. `bgcolor="#fff"` into `background-color: #fff`).
+type AttributeMapping struct {
+	Attribute string                    // The name of the HTML attribute
+	Property  string                    // The name of the CSS property, empty disables the attribute
+	Elements  []string                  // The elements that have this attribute, empty means every element
+	Transform func(value string) string // Optional transform applied to the attribute value
+}
+
+var defaultAttributeMappings = []*AttributeMapping{
+	{
+		Attribute: "align",
+		Property:  "float",
+		Elements:  []string{"img"},
+	},
+	{
+		Attribute: "align",
+		Property:  "text-align",
+		Elements:  []string{"h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "blockquote", "tr", "th", "td"},
+	},
+	{
+		Attribute: "bgcolor",
+		Property:  "background-color",
+		Elements:  []string{"body", "table", "tr", "th", "td"},
+	},
+	{
+		Attribute: "background",
+		Property:  "background-image",
+		Elements:  []string{"table"},
+	},
+	{
+		Attribute: "valign",
+		Property:  "vertical-align",
+		Elements:  []string{"th", "td"},
+	},
+	{
+		Attribute: "width",
+		Property:  "width",
+		Elements:  []string{"img", "table", "th", "td"},
+	},
+	{
+		Attribute: "height",
+		Property:  "height",
+		Elements:  []string{"img", "table", "th", "td"},
+	},
+}
+
+// PixelValue appends the `px` unit to unitless numeric values, so that
+// `width="600"` becomes `width: 600px`. Other values are returned unchanged.
+//
+// The default `width` and `height` mappings copy the attribute values as is, and
+// can be replaced by mappings using this transform with `WithAttributeMappings`.
+func PixelValue(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.Trim(value, "0123456789.") != "" {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return value
+	}
+
+	return value + "px"
+}
+
+func (mapping *AttributeMapping) appliesTo(elementName string) bool {
+	return len(mapping.Elements) == 0 || slices.Contains(mapping.Elements, elementName)
+}
+
+func (mapping *AttributeMapping) value(value string) string {
+	if mapping.Transform != nil {
+		return mapping.Transform(value)
+	}
+
+	return value
+}
+
+// mergeAttributeMappings adds the given mappings to the list. A mapping replaces
+// existing mappings with the same attribute and property, and a mapping without
+// property removes every mapping of its attribute.
+func mergeAttributeMappings(mappings []*AttributeMapping, updates ...*AttributeMapping) []*AttributeMapping {
+	for _, update := range updates {
+		mappings = slices.DeleteFunc(slices.Clone(mappings), func(mapping *AttributeMapping) bool {
+			return mapping.Attribute == update.Attribute && (update.Property == "" || mapping.Property == update.Property)
+		})
+
+		if update.Property != "" {
+			mappings = append(mappings, update)
+		}
+	}
+
+	return mappings
+}
@@ -0,0 +1,62 @@
+package cssinliner
+
+import "testing"
+
+func TestPixelValue(t *testing.T) {
+	cases := map[string]string{
+		"600":   "600px",
+		" 1.5 ": "1.5px",
+		"100%":  "100%",
+		"auto":  "auto",
+		"":      "",
+		".":     ".",
+		"1.2.3": "1.2.3",
+		"10px5": "10px5",
+	}
+
+	for value, expected := range cases {
+		if result := PixelValue(value); result != expected {
+			t.Errorf("PixelValue(%q): expected %q, got %q", value, expected, result)
+		}
+	}
+}
+
+func TestInlineWithAttributeMappings(t *testing.T) {
+	source := `<html><head><style>td, font { color: red; }</style></head><body>
+		<table><tr><td width="600" align="center" border="1">Cell</td></tr></table>
+		<font color="blue" face="Arial">Text</font>
+	</body></html>`
+	expected := `<html><head></head><body>
+		<table><tbody><tr><td width="600" align="center" border="1" style="border-width: 1px; color: red; width: 600px;">Cell</td></tr></tbody></table>
+		<font color="blue" face="Arial" style="color: blue; font-family: Arial;">Text</font>
+	</body></html>`
+
+	result, err := Inline(source, WithAttributeMappings(
+		&AttributeMapping{Attribute: "align"},
+		&AttributeMapping{Attribute: "width", Property: "width", Elements: []string{"td"}, Transform: PixelValue},
+		&AttributeMapping{Attribute: "border", Property: "border-width", Elements: []string{"td"}, Transform: PixelValue},
+		&AttributeMapping{Attribute: "color", Property: "color", Elements: []string{"font"}},
+		&AttributeMapping{Attribute: "face", Property: "font-family", Elements: []string{"font"}},
+	))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithDefaultAttributeMappings(t *testing.T) {
+	source := `<html><head><style>table, td { margin: 0; }</style></head><body><table width="600" height="100%"><tr><td width="50%" bgcolor="#fff">Cell</td></tr></table></body></html>`
+	expected := `<html><head></head><body><table width="600" height="100%" style="height: 100%; margin: 0; width: 600;"><tbody><tr><td width="50%" bgcolor="#fff" style="background-color: #fff; margin: 0; width: 50%;">Cell</td></tr></tbody></table></body></html>`
+
+	result, err := Inline(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go.baoshuo.dev/cssinliner"
+)
+
+// explain runs the `explain` subcommand, writing the declarations applying to the
+// elements matching a selector, and returns the exit code.
+func explain(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs, cfg := newFlagSet(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cssinliner explain [flags] selector [file]")
+		fmt.Fprintln(stderr, "Explains which declarations apply to the elements matching the selector, and why they win or lose.")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	input := "-"
+	if fs.NArg() == 2 {
+		input = fs.Arg(1)
+	}
+
+	var content []byte
+	var err error
+
+	if input == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(input)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 1
+	}
+
+	options, err := cfg.options(input, nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 2
+	}
+
+	explanations, err := cssinliner.Explain(string(content), fs.Arg(0), options...)
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %s: %v\n", input, err)
+		return 1
+	}
+
+	if cfg.json {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(explanations); err != nil {
+			return 1
+		}
+
+		return 0
+	}
+
+	writeExplanations(stdout, explanations)
+
+	return 0
+}
+
+func writeExplanations(w io.Writer, explanations []*cssinliner.Explanation) {
+	for i, explanation := range explanations {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, explanation.Element)
+
+		for _, declaration := range explanation.Declarations {
+			status := "won "
+			if !declaration.Won {
+				status = "lost"
+			}
+
+			value := declaration.Value
+			if declaration.Important {
+				value += " !important"
+			}
+
+			origin := declaration.Origin
+			if declaration.Selector != "" {
+				origin = fmt.Sprintf("%s (specificity %d, %s)", declaration.Selector, declaration.Specificity, declaration.Source)
+			}
+
+			fmt.Fprintf(w, "  [%s] %s: %s; from %s", status, declaration.Property, value, origin)
+			if declaration.Reason != "" {
+				fmt.Fprintf(w, ": %s", declaration.Reason)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRunExplain(t *testing.T) {
+	source := `<html><head><style>p { color: red; } .lead { color: blue; }</style></head><body><p class="lead" style="margin: 0;">Hello</p></body></html>`
+	expected := `p.lead
+  [lost] color: red; from p (specificity 1, style:1:20): overridden by ` + "`.lead`" + ` with a higher specificity (10 > 1)
+  [won ] color: blue; from .lead (specificity 10, style:1:38)
+  [won ] margin: 0; from style attribute
+`
+
+	var stdout, stderr strings.Builder
+
+	if code := run(context.Background(), []string{"explain", "p"}, strings.NewReader(source), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	if stdout.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, stdout.String())
+	}
+
+	if code := run(context.Background(), []string{"explain"}, strings.NewReader(source), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 without selector, got %d", code)
+	}
+}
@@ -0,0 +1,35 @@
+// Command cssinliner inlines the CSS styles of HTML documents read from files or
+// from the standard input.
+//
+// Usage:
+//
+//	cssinliner [flags] [file or glob ...]
+//
+// Without file, or with `-`, the document is read from the standard input.
+// With several files, the `-o` flag is required and names the output directory.
+// With the `-watch` flag, the files are inlined again whenever they or their local
+// stylesheets change, until the command is interrupted.
+//
+// The `serve` subcommand exposes the inliner as an HTTP API instead:
+//
+//	cssinliner serve [-addr host:port] [-max-body-bytes n] [-timeout duration] [flags]
+//
+// The `explain` subcommand writes the declarations applying to the elements matching
+// a selector, with the rules they come from and why they win or lose:
+//
+//	cssinliner explain [flags] selector [file]
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+
+	stop()
+	os.Exit(code)
+}
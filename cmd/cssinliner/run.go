@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"go.baoshuo.dev/cssinliner"
+	"go.baoshuo.dev/cssparser"
+)
+
+// Delimiters of the template placeholders, by name.
+var placeholderDelimiters = map[string][]cssinliner.Delimiters{
+	"go":        {cssinliner.GoTemplateDelimiters},
+	"liquid":    {cssinliner.GoTemplateDelimiters, cssinliner.LiquidTagDelimiters},
+	"mailchimp": {cssinliner.MailchimpDelimiters},
+}
+
+// config holds the command-line flags.
+type config struct {
+	remote                   bool          // Whether to fetch remote stylesheets
+	local                    bool          // Whether to read local stylesheets
+	base                     string        // Directory used to resolve local stylesheets
+	loose                    bool          // Whether to parse CSS loosely
+	presentationalAttributes bool          // Whether to write presentational attributes
+	keepStylePositions       bool          // Whether to keep non-inlinable rules in their <style> elements
+	pseudoClassStyles        bool          // Whether to insert dynamic pseudo-class rules in a dedicated <style> element
+	pseudoClassTarget        string        // Selector of the element receiving the pseudo-class rules
+	pseudoElements           bool          // Whether to materialize ::before and ::after pseudo-elements
+	removeUnusedCSS          bool          // Whether to remove unused CSS rules
+	removeUnusedClasses      bool          // Whether to remove unreferenced classes and ids
+	keepClasses              string        // Comma-separated classes and ids kept when removing unreferenced ones
+	minify                   bool          // Whether to minify the output CSS
+	fragment                 string        // Context element to parse the input as a fragment in
+	placeholders             string        // Comma-separated names of template placeholder syntaxes
+	css                      stringList    // Stylesheet files applied before the stylesheets of the documents
+	cssAfter                 stringList    // Stylesheet files applied after the stylesheets of the documents
+	xhtml                    bool          // Whether to render void elements with the XHTML syntax
+	preserveDoctype          bool          // Whether to output the doctype of the source document as is
+	preserveEntities         bool          // Whether to keep the named entities of the source document
+	singleQuotes             bool          // Whether to quote attribute values with single quotes
+	output                   string        // Output file, or output directory with several inputs
+	json                     bool          // Whether to write diagnostics as JSON
+	watch                    bool          // Whether to inline the inputs again when they change
+	interval                 time.Duration // Polling interval of the watch mode
+}
+
+func newFlagSet(stderr io.Writer) (*flag.FlagSet, *config) {
+	cfg := &config{}
+	fs := flag.NewFlagSet("cssinliner", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cssinliner [flags] [file or glob ...]")
+		fmt.Fprintln(stderr, "       cssinliner serve [flags]")
+		fmt.Fprintln(stderr, "       cssinliner explain [flags] selector [file]")
+		fmt.Fprintln(stderr, "Inlines the CSS styles of HTML documents read from files, or from the standard input.")
+		fs.PrintDefaults()
+	}
+
+	fs.BoolVar(&cfg.remote, "remote", false, "fetch remote stylesheets")
+	fs.BoolVar(&cfg.local, "local", false, "read local stylesheets")
+	fs.StringVar(&cfg.base, "base", "", "directory used to resolve local stylesheets (default: directory of each input, or current directory for stdin)")
+	fs.BoolVar(&cfg.loose, "loose", false, "parse CSS loosely, ignoring invalid declarations")
+	fs.BoolVar(&cfg.presentationalAttributes, "presentational-attributes", false, "write presentational attributes (width, bgcolor, align...) from inlined styles")
+	fs.BoolVar(&cfg.keepStylePositions, "keep-style-positions", false, "keep non-inlinable rules in their original <style> elements")
+	fs.BoolVar(&cfg.pseudoClassStyles, "pseudo-class-styles", true, "insert rules using dynamic pseudo-classes (:hover...) in a dedicated <style> element")
+	fs.StringVar(&cfg.pseudoClassTarget, "pseudo-class-target", "", "selector of the element receiving the dedicated <style> element (default: head)")
+	fs.BoolVar(&cfg.pseudoElements, "pseudo-elements", false, "materialize ::before and ::after pseudo-elements into <span> elements")
+	fs.BoolVar(&cfg.removeUnusedCSS, "remove-unused-css", false, "remove non-inlinable rules matching no element")
+	fs.BoolVar(&cfg.removeUnusedClasses, "remove-unused-classes", false, "remove classes and ids not referenced by the output stylesheets")
+	fs.StringVar(&cfg.keepClasses, "keep-classes", "", "comma-separated classes and ids kept by -remove-unused-classes")
+	fs.BoolVar(&cfg.minify, "minify", false, "minify the output stylesheets and style attributes")
+	fs.StringVar(&cfg.fragment, "fragment", "", "parse the input as a fragment in the given context element (e.g. body)")
+	fs.StringVar(&cfg.placeholders, "placeholders", "", "comma-separated template placeholder syntaxes to preserve (go, liquid, mailchimp)")
+	fs.Var(&cfg.css, "css", "stylesheet file applied before the stylesheets of the document (repeatable)")
+	fs.Var(&cfg.cssAfter, "css-after", "stylesheet file applied after the stylesheets of the document (repeatable)")
+	fs.BoolVar(&cfg.xhtml, "xhtml", false, "render void elements with the XHTML self-closing syntax")
+	fs.BoolVar(&cfg.preserveDoctype, "preserve-doctype", false, "output the doctype of the source document as is")
+	fs.BoolVar(&cfg.preserveEntities, "preserve-entities", false, "keep the named entities of the source document")
+	fs.BoolVar(&cfg.singleQuotes, "single-quotes", false, "quote attribute values with single quotes")
+	fs.StringVar(&cfg.output, "o", "", "output file, or output directory with several inputs (default: stdout)")
+	fs.BoolVar(&cfg.json, "json", false, "write diagnostics as JSON to stderr")
+	fs.BoolVar(&cfg.watch, "watch", false, "inline the input files again when they or their local stylesheets change (requires -o)")
+	fs.DurationVar(&cfg.interval, "interval", 500*time.Millisecond, "polling interval of the watch mode")
+
+	return fs, cfg
+}
+
+// options returns the inliner options for the input at the given path ("-" for stdin).
+func (cfg *config) options(path string, report *cssinliner.Report) ([]cssinliner.InlinerOption, error) {
+	options := []cssinliner.InlinerOption{
+		cssinliner.WithReport(report),
+		cssinliner.WithAllowLoadRemoteStylesheets(cfg.remote),
+		cssinliner.WithPresentationalAttributes(cfg.presentationalAttributes),
+		cssinliner.WithKeepStylePositions(cfg.keepStylePositions),
+		cssinliner.WithPseudoClassStyles(cfg.pseudoClassStyles, cfg.pseudoClassTarget),
+		cssinliner.WithMaterializePseudoElements(cfg.pseudoElements),
+		cssinliner.WithRemoveUnusedCSS(cfg.removeUnusedCSS),
+		cssinliner.WithRemoveUnusedClassesAndIDs(cfg.removeUnusedClasses, splitList(cfg.keepClasses)...),
+		cssinliner.WithMinify(cfg.minify),
+		cssinliner.WithFragmentContext(cfg.fragment),
+	}
+
+	if cfg.local {
+		options = append(options, cssinliner.WithAllowReadLocalFiles(true, cfg.htmlPath(path)))
+	}
+
+	if cfg.loose {
+		options = append(options, cssinliner.WithParserOptions(cssparser.WithLooseParsing(true)))
+	}
+
+	for _, stylesheets := range []struct {
+		position cssinliner.StylesheetPosition
+		paths    []string
+	}{
+		{cssinliner.BeforeDocumentStyles, cfg.css},
+		{cssinliner.AfterDocumentStyles, cfg.cssAfter},
+	} {
+		for _, cssPath := range stylesheets.paths {
+			css, err := os.ReadFile(cssPath)
+			if err != nil {
+				return nil, err
+			}
+
+			options = append(options, cssinliner.WithStylesheetsAt(stylesheets.position, string(css)))
+		}
+	}
+
+	if cfg.placeholders != "" {
+		delimiters, err := cfg.placeholderDelimiters()
+		if err != nil {
+			return nil, err
+		}
+
+		options = append(options, cssinliner.WithPlaceholders(delimiters...))
+	}
+
+	if cfg.xhtml || cfg.preserveDoctype || cfg.preserveEntities || cfg.singleQuotes {
+		outputOptions := cssinliner.OutputOptions{
+			XHTML:            cfg.xhtml,
+			PreserveDoctype:  cfg.preserveDoctype,
+			PreserveEntities: cfg.preserveEntities,
+		}
+		if cfg.singleQuotes {
+			outputOptions.AttributeQuote = cssinliner.AttributeQuoteSingle
+		}
+
+		options = append(options, cssinliner.WithOutputOptions(outputOptions))
+	}
+
+	return options, nil
+}
+
+// placeholderDelimiters returns the delimiters of the template placeholder syntaxes.
+func (cfg *config) placeholderDelimiters() ([]cssinliner.Delimiters, error) {
+	delimiters := []cssinliner.Delimiters{}
+
+	for _, name := range splitList(cfg.placeholders) {
+		if _, ok := placeholderDelimiters[name]; !ok {
+			return nil, fmt.Errorf("unknown placeholder syntax %q", name)
+		}
+		delimiters = append(delimiters, placeholderDelimiters[name]...)
+	}
+
+	return delimiters, nil
+}
+
+// htmlPath returns the path of the HTML document local stylesheets are resolved from.
+func (cfg *config) htmlPath(path string) string {
+	if path == "-" {
+		path = "stdin"
+	}
+
+	if cfg.base != "" {
+		return filepath.Join(cfg.base, filepath.Base(path))
+	}
+
+	return path
+}
+
+// result is the outcome of inlining an input, written as JSON diagnostics.
+type result struct {
+	Input  string             `json:"input"`
+	Output string             `json:"output,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	Report *cssinliner.Report `json:"report"`
+}
+
+// run runs the command with the given arguments, and returns the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "serve" {
+		return serve(ctx, args[1:], stderr)
+	}
+	if len(args) > 0 && args[0] == "explain" {
+		return explain(args[1:], stdin, stdout, stderr)
+	}
+
+	fs, cfg := newFlagSet(stderr)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if _, err := cfg.placeholderDelimiters(); err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 2
+	}
+
+	inputs, err := expandInputs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 2
+	}
+
+	if cfg.watch && (cfg.output == "" || slices.Contains(inputs, "-")) {
+		fmt.Fprintln(stderr, "cssinliner: the -watch flag requires input files and the -o flag")
+		return 2
+	}
+
+	// with several inputs or globs, the output is a directory
+	outputs := make([]string, len(inputs))
+	for i := range outputs {
+		outputs[i] = cfg.output
+	}
+
+	if isBatch(fs.Args()) {
+		if cfg.output == "" {
+			fmt.Fprintln(stderr, "cssinliner: the -o flag is required with several inputs")
+			return 2
+		}
+
+		if outputs, err = batchOutputs(cfg.output, inputs); err != nil {
+			fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+			return 2
+		}
+	}
+
+	results := []*result{}
+	exitCode := 0
+
+	for i, input := range inputs {
+		res := &result{Input: input, Output: outputs[i]}
+
+		if !inlineInput(ctx, cfg, res, stdin, stdout) {
+			exitCode = 1
+		}
+
+		results = append(results, res)
+	}
+
+	if err := writeResults(cfg, results, stderr); err != nil {
+		return 1
+	}
+
+	if cfg.watch {
+		return watch(ctx, cfg, results, stderr)
+	}
+
+	return exitCode
+}
+
+// writeResults writes the diagnostics and the errors of the results to stderr.
+func writeResults(cfg *config, results []*result, stderr io.Writer) error {
+	if cfg.json {
+		encoder := json.NewEncoder(stderr)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(results)
+	}
+
+	for _, res := range results {
+		for _, diagnostic := range res.Report.Diagnostics {
+			if _, err := fmt.Fprintf(stderr, "%s: %s: %s\n", res.Input, diagnostic.Source, diagnostic.Message); err != nil {
+				return err
+			}
+		}
+		if res.Error != "" {
+			if _, err := fmt.Fprintf(stderr, "%s: %s\n", res.Input, res.Error); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// inlineInput inlines an input file, or the standard input, into the result output,
+// and returns whether it succeeded.
+func inlineInput(ctx context.Context, cfg *config, res *result, stdin io.Reader, stdout io.Writer) bool {
+	res.Report = &cssinliner.Report{}
+	res.Error = ""
+
+	if err := inlineInputTo(ctx, cfg, res, stdin, stdout); err != nil {
+		res.Error = err.Error()
+		return false
+	}
+
+	return true
+}
+
+// inlineInputTo inlines an input until the context is done, e.g. when the command is
+// interrupted while fetching remote stylesheets.
+func inlineInputTo(ctx context.Context, cfg *config, res *result, stdin io.Reader, stdout io.Writer) error {
+	var content []byte
+	var err error
+
+	if res.Input == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(res.Input)
+	}
+	if err != nil {
+		return err
+	}
+
+	options, err := cfg.options(res.Input, res.Report)
+	if err != nil {
+		return err
+	}
+
+	var inlined strings.Builder
+	if err := cssinliner.InlineReader(ctx, bytes.NewReader(content), &inlined, options...); err != nil {
+		return err
+	}
+	html := inlined.String()
+
+	if res.Output == "" {
+		_, err = io.WriteString(stdout, html)
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(res.Output), 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(res.Output, []byte(html), 0o644)
+}
+
+// stringList is a flag value collecting the values of a repeated flag.
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
+// isBatch returns whether the arguments are several inputs or glob patterns, which
+// are written into the output directory.
+func isBatch(args []string) bool {
+	return len(args) > 1 || (len(args) == 1 && isGlob(args[0]))
+}
+
+func isGlob(arg string) bool {
+	return arg != "-" && strings.ContainsAny(arg, "*?[")
+}
+
+// batchOutputs returns the output paths of the inputs in the output directory, which
+// keep their paths relative to the closest directory containing all of them.
+func batchOutputs(output string, inputs []string) ([]string, error) {
+	if slices.Contains(inputs, "-") {
+		return nil, errors.New("the standard input can't be inlined along with other inputs")
+	}
+
+	paths := make([]string, len(inputs))
+	for i, input := range inputs {
+		path, err := filepath.Abs(input)
+		if err != nil {
+			return nil, err
+		}
+		paths[i] = path
+	}
+
+	base := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !strings.HasPrefix(path, base+string(filepath.Separator)) && base != filepath.Dir(base) {
+			base = filepath.Dir(base)
+		}
+	}
+
+	result := []string{}
+	for i, path := range paths {
+		relPath, err := filepath.Rel(base, path)
+		if err != nil {
+			return nil, err
+		}
+
+		outputPath := filepath.Join(output, relPath)
+		if j := slices.Index(result, outputPath); j >= 0 {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", inputs[j], inputs[i], outputPath)
+		}
+
+		result = append(result, outputPath)
+	}
+
+	return result, nil
+}
+
+// expandInputs expands the glob patterns of the arguments, which default to the
+// standard input.
+func expandInputs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return []string{"-"}, nil
+	}
+
+	result := []string{}
+	for _, arg := range args {
+		if !isGlob(arg) {
+			result = append(result, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no file matches %s", arg)
+		}
+
+		result = append(result, matches...)
+	}
+
+	return result, nil
+}
+
+func splitList(list string) []string {
+	result := []string{}
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
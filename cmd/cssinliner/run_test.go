@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunStdin(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello World</p></body></html>`
+	expected := `<html><head></head><body><p style="color:red">Hello World</p></body></html>`
+
+	var stdout, stderr strings.Builder
+
+	if code := run(context.Background(), []string{"-minify"}, strings.NewReader(source), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	if stdout.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, stdout.String())
+	}
+}
+
+func TestRunStylesheets(t *testing.T) {
+	dir := t.TempDir()
+	before, after := filepath.Join(dir, "before.css"), filepath.Join(dir, "after.css")
+
+	if err := os.WriteFile(before, []byte("p { color: blue; margin: 0; }"), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := os.WriteFile(after, []byte("p { padding: 0; color: green; }"), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	source := `<html><head><style>p { color: red; padding: 1px; }</style></head><body><p>Hello World</p></body></html>`
+	expected := `<html><head></head><body><p style="color:green;margin:0;padding:0">Hello World</p></body></html>`
+
+	var stdout, stderr strings.Builder
+
+	args := []string{"-minify", "-css", before, "-css-after", after}
+	if code := run(context.Background(), args, strings.NewReader(source), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	if stdout.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, stdout.String())
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var stdout, stderr strings.Builder
+
+	if code := run(ctx, nil, strings.NewReader(`<p>Hello</p>`), &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1 once interrupted, got %d", code)
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "out")
+
+	files := map[string]string{
+		"style.css": `p { color: red; }`,
+		"a.html":    `<html><head><link rel="stylesheet" href="style.css"></head><body><p>A</p></body></html>`,
+		"b.html":    `<html><head><link rel="stylesheet" href="missing.css"></head><body><p>B</p></body></html>`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	var stdout, stderr strings.Builder
+
+	args := []string{"-local", "-json", "-o", outputDir, filepath.Join(dir, "*.html")}
+	if code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	output, err := os.ReadFile(filepath.Join(outputDir, "a.html"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `<html><head></head><body><p style="color: red;">A</p></body></html>`
+	if string(output) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(output))
+	}
+
+	var results []*result
+	if err := json.Unmarshal([]byte(stderr.String()), &results); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(results) != 2 || len(results[0].Report.Diagnostics) != 0 || len(results[1].Report.Diagnostics) != 1 {
+		t.Errorf("Expected a diagnostic for the missing stylesheet of b.html, got %s", stderr.String())
+	}
+}
+
+func TestRunBatchNestedInputs(t *testing.T) {
+	dir := t.TempDir()
+	outputDir := filepath.Join(dir, "out")
+
+	for _, name := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(dir, "src", name), 0o755); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		content := `<html><head><style>p { color: red; }</style></head><body><p>` + name + `</p></body></html>`
+		if err := os.WriteFile(filepath.Join(dir, "src", name, "index.html"), []byte(content), 0o644); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	var stdout, stderr strings.Builder
+
+	args := []string{"-o", outputDir, filepath.Join(dir, "src", "*", "index.html")}
+	if code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	for _, name := range []string{"a", "b"} {
+		output, err := os.ReadFile(filepath.Join(outputDir, name, "index.html"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		expected := `<html><head></head><body><p style="color: red;">` + name + `</p></body></html>`
+		if string(output) != expected {
+			t.Errorf("Expected %s, got %s", expected, string(output))
+		}
+	}
+
+	// a glob matching a single file still writes into the output directory
+	args = []string{"-o", outputDir, filepath.Join(dir, "src", "a", "*.html")}
+	if code := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "index.html")); err != nil {
+		t.Errorf("Expected the output in the output directory, got %v", err)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	var stdout, stderr strings.Builder
+
+	if code := run(context.Background(), []string{filepath.Join(dir, "*.html")}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for a glob matching no file, got %d", code)
+	}
+
+	if code := run(context.Background(), []string{"a.html", "b.html"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for several inputs without -o, got %d", code)
+	}
+
+	if code := run(context.Background(), []string{"-placeholders", "unknown"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown placeholder syntax, got %d", code)
+	}
+
+	if code := run(context.Background(), []string{"-o", dir, "a.html", "a.html"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for inputs written to the same output, got %d", code)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	dir := t.TempDir()
+	htmlPath := filepath.Join(dir, "index.html")
+	cssPath := filepath.Join(dir, "style.css")
+	outputPath := filepath.Join(dir, "output.html")
+
+	if err := os.WriteFile(htmlPath, []byte(`<html><head><link rel="stylesheet" href="style.css"></head><body>Watch</body></html>`), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := os.WriteFile(cssPath, []byte(`body { color: red; }`), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+
+	go func() {
+		var stdout, stderr strings.Builder
+		done <- run(ctx, []string{"-local", "-watch", "-interval", "10ms", "-o", outputPath, htmlPath}, strings.NewReader(""), &stdout, &stderr)
+	}()
+
+	waitForOutput := func(expected string) {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if output, err := os.ReadFile(outputPath); err == nil && string(output) == expected {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatalf("Expected output %s", expected)
+	}
+
+	waitForOutput(`<html><head></head><body style="color: red;">Watch</body></html>`)
+
+	// ensure the modification time changes on file systems with a coarse resolution
+	later := time.Now().Add(time.Second)
+	if err := os.WriteFile(cssPath, []byte(`body { color: blue; }`), 0o644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := os.Chtimes(cssPath, later, later); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	waitForOutput(`<html><head></head><body style="color: blue;">Watch</body></html>`)
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"go.baoshuo.dev/cssinliner"
+)
+
+// serve runs the `serve` subcommand, exposing the inliner as an HTTP API until the
+// context is done, and returns the exit code.
+func serve(ctx context.Context, args []string, stderr io.Writer) int {
+	fs, cfg := newFlagSet(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: cssinliner serve [flags]")
+		fmt.Fprintln(stderr, "Serves the inliner as an HTTP API, accepting HTML or JSON documents via POST.")
+		fs.PrintDefaults()
+	}
+
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	maxBodyBytes := fs.Int64("max-body-bytes", cssinliner.DefaultMaxBodyBytes, "maximum size of request bodies")
+	timeout := fs.Duration("timeout", 10*time.Second, "maximum duration of the inlining of a request (0 for unlimited)")
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// requests must not read the files nor reach the hosts the server has access to
+	if cfg.local || cfg.remote {
+		fmt.Fprintln(stderr, "cssinliner: the -local and -remote flags can't be used with serve")
+		return 2
+	}
+
+	options, err := cfg.options("-", nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 2
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 1
+	}
+
+	return serveListener(ctx, listener, &cssinliner.Handler{
+		Options:      options,
+		MaxBodyBytes: *maxBodyBytes,
+		Timeout:      *timeout,
+	}, stderr)
+}
+
+func serveListener(ctx context.Context, listener net.Listener, handler http.Handler, stderr io.Writer) int {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(stderr, "cssinliner: listening on %s\n", listener.Addr())
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(stderr, "cssinliner: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
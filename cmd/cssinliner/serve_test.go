@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.baoshuo.dev/cssinliner"
+)
+
+func TestServeListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+
+	go func() {
+		var stderr strings.Builder
+		done <- serveListener(ctx, listener, &cssinliner.Handler{}, &stderr)
+	}()
+
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello Server</p></body></html>`
+	expected := `<html><head></head><body><p style="color: red;">Hello Server</p></body></html>`
+
+	resp, err := http.Post("http://"+listener.Addr().String(), "text/html", strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	response := &cssinliner.HandlerResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if response.HTML != expected {
+		t.Errorf("Expected %s, got %s", expected, response.HTML)
+	}
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+}
+
+func TestServeUsageErrors(t *testing.T) {
+	var stdout, stderr strings.Builder
+
+	if code := run(context.Background(), []string{"serve", "-placeholders", "unknown"}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+		t.Errorf("Expected exit code 2 for an unknown placeholder syntax, got %d", code)
+	}
+
+	for _, flag := range []string{"-local", "-remote"} {
+		if code := run(context.Background(), []string{"serve", flag}, strings.NewReader(""), &stdout, &stderr); code != 2 {
+			t.Errorf("Expected exit code 2 for %s, got %d", flag, code)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// watchedInput is an input file inlined again when it or its local stylesheets change.
+type watchedInput struct {
+	res      *result
+	modTimes map[string]time.Time // Modification times of the watched files, zero for missing ones
+}
+
+func newWatchedInput(res *result) *watchedInput {
+	input := &watchedInput{res: res}
+	input.modTimes = input.currentModTimes()
+
+	return input
+}
+
+// files returns the input file and the local stylesheets resolved when inlining it.
+func (input *watchedInput) files() []string {
+	return append([]string{input.res.Input}, input.res.Report.LocalFiles...)
+}
+
+func (input *watchedInput) currentModTimes() map[string]time.Time {
+	result := make(map[string]time.Time)
+
+	for _, path := range input.files() {
+		if info, err := os.Stat(path); err == nil {
+			result[path] = info.ModTime()
+		} else {
+			result[path] = time.Time{}
+		}
+	}
+
+	return result
+}
+
+// addModTimes snapshots the modification times of the watched files added since the
+// last check, so that the changes made while inlining are detected by the next one.
+func (input *watchedInput) addModTimes() {
+	for path, modTime := range input.currentModTimes() {
+		if _, ok := input.modTimes[path]; !ok {
+			input.modTimes[path] = modTime
+		}
+	}
+}
+
+// changed returns whether one of the watched files changed since the last check.
+func (input *watchedInput) changed() bool {
+	modTimes := input.currentModTimes()
+	changed := false
+
+	for path, modTime := range modTimes {
+		if !modTime.Equal(input.modTimes[path]) {
+			changed = true
+		}
+	}
+
+	input.modTimes = modTimes
+
+	return changed
+}
+
+// watch polls the files of the inlined inputs, and inlines again the inputs whose
+// files changed, until the context is done.
+func watch(ctx context.Context, cfg *config, results []*result, stderr io.Writer) int {
+	inputs := []*watchedInput{}
+	for _, res := range results {
+		inputs = append(inputs, newWatchedInput(res))
+	}
+
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+
+		for _, input := range inputs {
+			if !input.changed() {
+				continue
+			}
+
+			inlineInput(ctx, cfg, input.res, nil, nil)
+			if input.res.Error == "" {
+				fmt.Fprintf(stderr, "%s: inlined into %s\n", input.res.Input, input.res.Output)
+			}
+
+			// the local stylesheets may have changed, the ones added since the check are
+			// snapshotted now
+			input.addModTimes()
+
+			if err := writeResults(cfg, []*result{input.res}, stderr); err != nil {
+				return 1
+			}
+		}
+	}
+}
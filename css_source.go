@@ -0,0 +1,136 @@
+package cssinliner
+
+import (
+	"fmt"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// CssSourceKind is the kind of a CSS source.
+type CssSourceKind int
+
+const (
+	StyleElementSource   CssSourceKind = iota // A <style> element of the document
+	LocalFileSource                           // A local stylesheet file of a <link> element
+	RemoteFileSource                          // A remote stylesheet of a <link> element
+	InjectedSource                            // A stylesheet supplied with WithStylesheets or WithStylesheetsAt
+	StyleAttributeSource                      // The `style` attribute of an element
+)
+
+func (kind CssSourceKind) String() string {
+	switch kind {
+	case StyleElementSource:
+		return "style"
+	case LocalFileSource:
+		return "local"
+	case RemoteFileSource:
+		return "remote"
+	case InjectedSource:
+		return "injected"
+	case StyleAttributeSource:
+		return "attribute"
+	}
+
+	return "unknown"
+}
+
+// CssSource describes where a CSS text comes from.
+type CssSource struct {
+	Kind    CssSourceKind      // Kind of the source
+	Path    string             // Path or URL of the stylesheet file, empty for other sources
+	Element *goquery.Selection // The <style>, <link> or styled element, nil for injected stylesheets
+	Line    int                // Line of the rule in the source document or stylesheet, starting at 1, 0 if unknown or not a rule
+	Column  int                // Column of the rule in the source document or stylesheet, starting at 1, 0 if unknown or not a rule
+}
+
+// String returns the path or URL of a stylesheet file, or the kind of the source,
+// followed by the position of the rule if known.
+func (source *CssSource) String() string {
+	result := source.Path
+	if result == "" {
+		result = source.Kind.String()
+	}
+
+	if source.Line > 0 {
+		result += fmt.Sprintf(":%d:%d", source.Line, source.Column)
+	}
+
+	return result
+}
+
+// setStyleNodeSource records the source of the CSS of a <style> element created by the inliner.
+func (inliner *Inliner) setStyleNodeSource(styleNode *html.Node, source *CssSource) {
+	if inliner.styleNodeSources == nil {
+		inliner.styleNodeSources = make(map[*html.Node]*CssSource)
+	}
+
+	inliner.styleNodeSources[styleNode] = source
+}
+
+// setStyleNodePositions records the positions of the rules of a <style> element in its
+// source document or stylesheet file.
+func (inliner *Inliner) setStyleNodePositions(styleNode *html.Node, positions []cssPosition) {
+	if inliner.styleNodePositions == nil {
+		inliner.styleNodePositions = make(map[*html.Node][]cssPosition)
+	}
+
+	inliner.styleNodePositions[styleNode] = positions
+}
+
+// preprocessCss applies the CSS preprocessor to a CSS text.
+func (inliner *Inliner) preprocessCss(css string, source *CssSource) (string, error) {
+	if inliner.cssPreprocessor == nil {
+		return css, nil
+	}
+
+	return inliner.cssPreprocessor(css, source)
+}
+
+// preprocessCssFile applies the CSS file preprocessor and the CSS preprocessor to
+// the CSS of a stylesheet file, reporting failures as diagnostics.
+func (inliner *Inliner) preprocessCssFile(css string, source *CssSource) (string, bool) {
+	if inliner.cssFilePreprocessor != nil {
+		processedCss, err := inliner.cssFilePreprocessor(css, source.Path)
+		if err != nil {
+			inliner.report.addDiagnostic(source.Path, "failed to preprocess stylesheet: %v", err)
+			return "", false
+		}
+		css = processedCss
+	}
+
+	css, err := inliner.preprocessCss(css, source)
+	if err != nil {
+		inliner.report.addDiagnostic(source.Path, "failed to preprocess stylesheet: %v", err)
+		return "", false
+	}
+
+	return css, true
+}
+
+// preprocessStyleAttributes applies the CSS preprocessor to the `style` attributes.
+func (inliner *Inliner) preprocessStyleAttributes() error {
+	if inliner.cssPreprocessor == nil || !inliner.preprocessStyleAttrs {
+		return nil
+	}
+
+	var result error
+
+	inliner.find("[style]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if inlinerDirective(s) == inlinerIgnore {
+			return true
+		}
+
+		css, err := inliner.cssPreprocessor(s.AttrOr("style", ""), &CssSource{Kind: StyleAttributeSource, Element: s})
+		if err != nil {
+			result = err
+			return false
+		}
+
+		s.SetAttr("style", css)
+
+		return true
+	})
+
+	return result
+}
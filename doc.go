@@ -12,6 +12,7 @@ Here's a brief overview of the main functions:
 The available options include:
 - WithAllowLoadRemoteStylesheets(allow bool): Allows the inliner to fetch remote stylesheets.
 - WithAllowReadLocalFiles(allow bool, path string): Allows the inliner to fetch local stylesheets from the specified path.
+- WithAttributeMappings(mappings ...*AttributeMapping): Adds, replaces or disables presentational attribute mappings.
 
 The source code of this package is hosted on GitHub: https://github.com/renbaoshuo/go-css-inliner
 */
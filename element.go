@@ -1,8 +1,9 @@
 package cssinliner
 
 import (
-	"slices"
+	"errors"
 	"sort"
+	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	cssparser "go.baoshuo.dev/cssparser"
@@ -12,50 +13,20 @@ type Element struct {
 	element       *goquery.Selection // The goquery handler
 	styleRules    []*StyleRule       // The style rules to apply on that element
 	parserOptions []cssparser.ParserOption
-}
-
-type AttrToStyleRule struct {
-	styleName string   // The name of the style property
-	elements  []string // The elements that have this style property
-}
 
-var attrToStyle = map[string][]*AttrToStyleRule{
-	"align": {
-		{
-			"float",
-			[]string{"img"},
-		},
-		{
-			"text-align",
-			[]string{"h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "blockquote", "tr", "th", "td"},
-		},
-	},
-	"bgcolor": {{
-		"background-color",
-		[]string{"body", "table", "tr", "th", "td"},
-	}},
-	"background": {{
-		"background-image",
-		[]string{"table"},
-	}},
-	"valign": {{
-		"vertical-align",
-		[]string{"th", "td"},
-	}},
-	"width": {{
-		"width",
-		[]string{"img", "table", "th", "td"},
-	}},
-	"height": {{
-		"height",
-		[]string{"img", "table", "th", "td"},
-	}},
+	attributeMappings        []*AttributeMapping        // Presentational attributes converted into declarations
+	presentationalAttributes []*PresentationalAttribute // Declarations written back as presentational attributes
+	minify                   bool                       // Whether to minify the style attribute
+	stylePlaceholders        []string                   // Placeholder tokens standing for whole declarations in the style attribute
+	hook                     ElementHook                // Optional hook modifying the winning declarations
+	declarationHook          DeclarationHook            // Optional hook modifying each winning declaration
 }
 
 func NewElement(element *goquery.Selection, parserOptions ...cssparser.ParserOption) *Element {
 	return &Element{
-		element:       element,
-		parserOptions: parserOptions,
+		element:           element,
+		parserOptions:     parserOptions,
+		attributeMappings: defaultAttributeMappings,
 	}
 }
 
@@ -65,22 +36,102 @@ func (element *Element) addStyleRule(styleRule *StyleRule) {
 
 func (element *Element) inline() error {
 	// compute declarations
-	declarations, err := element.computeDeclarations()
+	styleDecls, err := element.computeDeclarations()
 	if err != nil {
 		return err
 	}
 
-	// set style attribute
-	styleValue := computeStyleValue(declarations)
-	if styleValue != "" {
-		element.element.SetAttr("style", styleValue)
+	changed := len(element.styleRules) > 0
+	hooked := element.hook != nil || element.declarationHook != nil
+	if hooked {
+		computed := declarationsText(styleDecls)
+
+		if styleDecls, err = element.applyHooks(styleDecls); err != nil {
+			return err
+		}
+
+		changed = changed || declarationsText(styleDecls) != computed
+	}
+
+	declarations := []*cssparser.Declaration{}
+	for _, styleDecl := range styleDecls {
+		declarations = append(declarations, styleDecl.Declaration)
 	}
 
+	// set style attribute, unless the element is only styled by its attributes, or
+	// its declarations are unchanged
+	if changed {
+		styleValue := computeStyleValue(declarations, element.minify)
+		styleValue = appendStylePlaceholders(styleValue, element.stylePlaceholders, element.minify)
+		if styleValue != "" {
+			element.element.SetAttr("style", styleValue)
+		} else if hooked {
+			element.element.RemoveAttr("style") // every declaration was removed by the hooks
+		}
+	}
+
+	// set presentational attributes
+	element.setPresentationalAttributes(declarations)
+
 	return nil
 }
 
-func (element *Element) computeDeclarations() ([]*cssparser.Declaration, error) {
-	result := []*cssparser.Declaration{}
+// applyHooks runs the declaration hook on each winning declaration, then the element
+// hook on the remaining ones.
+func (element *Element) applyHooks(styleDecls []*StyleDeclaration) ([]*StyleDeclaration, error) {
+	if element.declarationHook != nil {
+		result := []*StyleDeclaration{}
+
+		for _, styleDecl := range styleDecls {
+			styleDecl, err := element.declarationHook(element.element, styleDecl)
+			if err != nil {
+				return nil, err
+			}
+
+			if styleDecl == nil {
+				continue // dropped by the hook
+			}
+			if styleDecl.Declaration == nil {
+				return nil, errors.New("declaration hook returned a declaration without its CSS declaration")
+			}
+
+			result = append(result, styleDecl)
+		}
+
+		styleDecls = result
+	}
+
+	if element.hook != nil {
+		var err error
+		if styleDecls, err = element.hook(element.element, styleDecls); err != nil {
+			return nil, err
+		}
+
+		for _, styleDecl := range styleDecls {
+			if styleDecl == nil || styleDecl.Declaration == nil {
+				return nil, errors.New("element hook returned a declaration without its CSS declaration")
+			}
+		}
+	}
+
+	return styleDecls, nil
+}
+
+// declarationsText returns the text of the declarations, to detect changes made by the hook.
+func declarationsText(styleDecls []*StyleDeclaration) string {
+	result := ""
+	for _, styleDecl := range styleDecls {
+		if styleDecl != nil && styleDecl.Declaration != nil {
+			result += styleDecl.Declaration.String() + "\n"
+		}
+	}
+
+	return result
+}
+
+// computeDeclarations returns the winning declarations, sorted by property name.
+func (element *Element) computeDeclarations() ([]*StyleDeclaration, error) {
+	result := []*StyleDeclaration{}
 
 	styles := make(map[string]*StyleDeclaration)
 
@@ -104,11 +155,13 @@ func (element *Element) computeDeclarations() ([]*cssparser.Declaration, error)
 
 	// map to array
 	for _, styleDecl := range styles {
-		result = append(result, styleDecl.Declaration)
+		result = append(result, styleDecl)
 	}
 
 	// sort declarations by property name
-	sort.Sort(cssparser.DeclarationsByProperty(result))
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Declaration.Property < result[j].Declaration.Property
+	})
 
 	return result, nil
 }
@@ -117,29 +170,49 @@ func (element *Element) parseAttributes() ([]*StyleRule, error) {
 	result := []*StyleRule{}
 	declarations := []*cssparser.Declaration{}
 
-	for attr, rules := range attrToStyle {
-		value, exists := element.element.Attr(attr)
-		if !exists || value == "" {
+	for _, mapping := range element.attributeMappings {
+		if !mapping.appliesTo(element.element.Nodes[0].Data) {
 			continue
 		}
 
-		for _, rule := range rules {
-			if slices.Contains(rule.elements, element.element.Nodes[0].Data) {
-				declarations = append(declarations, &cssparser.Declaration{
-					Property: rule.styleName,
-					Value:    value,
-				})
-			}
+		value, exists := element.element.Attr(mapping.Attribute)
+		if !exists || value == "" {
+			continue
 		}
+
+		declarations = append(declarations, &cssparser.Declaration{
+			Property: mapping.Property,
+			Value:    mapping.value(value),
+		})
 	}
 
 	if len(declarations) > 0 {
-		result = append(result, NewStyleRule(inlineFakeSelector, declarations))
+		result = append(result, NewStyleRule(attributeFakeSelector, declarations))
 	}
 
 	return result, nil
 }
 
+func (element *Element) setPresentationalAttributes(declarations []*cssparser.Declaration) {
+	elementName := element.element.Nodes[0].Data
+
+	for _, attribute := range element.presentationalAttributes {
+		if attribute.Table || !attribute.appliesTo(elementName) {
+			continue
+		}
+
+		for _, declaration := range declarations {
+			if declaration.Property != attribute.Property {
+				continue
+			}
+
+			if value, ok := attribute.value(declaration); ok {
+				element.element.SetAttr(attribute.Attribute, value)
+			}
+		}
+	}
+}
+
 func (element *Element) parseInlineStyle() ([]*StyleRule, error) {
 	result := []*StyleRule{}
 
@@ -148,6 +221,12 @@ func (element *Element) parseInlineStyle() ([]*StyleRule, error) {
 		return result, nil
 	}
 
+	// placeholders standing for whole declarations are kept out of CSS parsing
+	styleValue, element.stylePlaceholders = extractStylePlaceholders(styleValue)
+	if strings.TrimSpace(styleValue) == "" {
+		return result, nil
+	}
+
 	declarations, err := cssparser.ParseDeclarations(styleValue, element.parserOptions...)
 	if err != nil {
 		return result, err
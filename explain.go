@@ -0,0 +1,326 @@
+package cssinliner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// Origins of the declarations applying to an element.
+const (
+	StylesheetOrigin              = "stylesheet"               // A rule of a stylesheet
+	StyleAttributeOrigin          = "style attribute"          // The `style` attribute of the element
+	PresentationalAttributeOrigin = "presentational attribute" // A presentational attribute of the element (e.g. `bgcolor`)
+	HookOrigin                    = "hook"                     // The element hook or the declaration hook
+)
+
+// Explanation lists the declarations applying to an element, as found by Explain.
+type Explanation struct {
+	Element      string                    `json:"element"`      // Description of the element (e.g. `p#intro.lead`)
+	Declarations []*DeclarationExplanation `json:"declarations"` // Candidate declarations, by property and in cascade order
+}
+
+// DeclarationExplanation describes a candidate declaration of an element, and whether
+// it's the one inlined for its property.
+type DeclarationExplanation struct {
+	Property    string `json:"property"`
+	Value       string `json:"value"`
+	Important   bool   `json:"important,omitempty"`
+	Selector    string `json:"selector,omitempty"` // Selector of the rule, empty for attributes
+	Specificity int    `json:"specificity"`        // Specificity of the selector
+	Origin      string `json:"origin"`             // Origin of the declaration (e.g. StylesheetOrigin)
+	Source      string `json:"source,omitempty"`   // Path or URL of the stylesheet file, or kind of the stylesheet, with the position of the rule
+	Line        int    `json:"line,omitempty"`     // Line of the rule in the stylesheet, 0 if unknown
+	Column      int    `json:"column,omitempty"`   // Column of the rule in the stylesheet, 0 if unknown
+	Won         bool   `json:"won"`                // Whether the declaration is the inlined one
+	Reason      string `json:"reason,omitempty"`   // Why the declaration lost
+}
+
+// Explain returns, for each element matching the selector, every declaration that
+// could apply to it, with the rule it comes from and why it won or lost.
+func Explain(html string, selector string, options ...InlinerOption) ([]*Explanation, error) {
+	return NewInliner(html, options...).Explain(selector)
+}
+
+// ExplainNode returns every declaration that could apply to the given element, within
+// the document holding it, with the rule it comes from and why it won or lost. The
+// document is left untouched.
+func ExplainNode(node *html.Node, options ...InlinerOption) (*Explanation, error) {
+	if node == nil || node.Type != html.ElementNode {
+		return nil, errors.New("only element nodes can be explained")
+	}
+
+	root := node
+	for root.Parent != nil {
+		root = root.Parent
+	}
+
+	// the styles are collected from a copy, as collecting them modifies the document
+	clones := map[*html.Node]*html.Node{}
+	inliner := NewInliner("", options...)
+	inliner.ctx = context.Background()
+	inliner.doc = goquery.NewDocumentFromNode(cloneTree(root, clones))
+	inliner.used = true
+
+	if err := inliner.collect(); err != nil {
+		return nil, err
+	}
+
+	explanations, err := inliner.explainElements(goquery.NewDocumentFromNode(clones[node]).Selection)
+	if err != nil {
+		return nil, err
+	}
+
+	return explanations[0], nil
+}
+
+// Explain returns, for each element matching the selector, every declaration that
+// could apply to it, with the rule it comes from and why it won or lost.
+//
+// NOTE: Like Inline, Explain processes the document of the inliner, so an inliner can
+// only be used once.
+func (inliner *Inliner) Explain(selector string) ([]*Explanation, error) {
+	if _, err := cascadia.Compile(matchableSelector(selector)); err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+
+	if inliner.used {
+		return nil, errInlinerUsed
+	}
+	inliner.used = true
+
+	inliner.ctx = context.Background()
+
+	if err := inliner.prepareHTML(); err != nil {
+		return nil, err
+	}
+	if err := inliner.parseHTML(strings.NewReader(inliner.html)); err != nil {
+		return nil, err
+	}
+	if err := inliner.collect(); err != nil {
+		return nil, err
+	}
+
+	return inliner.explainElements(inliner.find(selector))
+}
+
+// explainElements returns the explanations of the given elements, once the styles are collected.
+func (inliner *Inliner) explainElements(elements *goquery.Selection) ([]*Explanation, error) {
+	result := []*Explanation{}
+	var explainErr error
+
+	elements.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		// as when inlining, the hooks only apply to the elements receiving styles
+		element := inliner.newElement(s)
+		element.hook, element.declarationHook = nil, nil
+		if marker, ok := s.Attr(elementMarkerAttr); ok {
+			element = inliner.elements[marker]
+		}
+
+		declarations, err := element.explain()
+		if err != nil {
+			explainErr = err
+			return false
+		}
+
+		result = append(result, &Explanation{
+			Element:      describeElement(s),
+			Declarations: declarations,
+		})
+
+		return true
+	})
+
+	return result, explainErr
+}
+
+// cloneTree returns a deep copy of the tree rooted at the node, recording the copy of
+// each node.
+func cloneTree(node *html.Node, clones map[*html.Node]*html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      node.Type,
+		DataAtom:  node.DataAtom,
+		Data:      node.Data,
+		Namespace: node.Namespace,
+		Attr:      append([]html.Attribute(nil), node.Attr...),
+	}
+	clones[node] = clone
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		clone.AppendChild(cloneTree(child, clones))
+	}
+
+	return clone
+}
+
+// explain returns the candidate declarations of the element, resolved as in computeDeclarations.
+func (element *Element) explain() ([]*DeclarationExplanation, error) {
+	attrRules, err := element.parseAttributes()
+	if err != nil {
+		return nil, err
+	}
+
+	inlineRules, err := element.parseInlineStyle()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*StyleDeclaration{}
+	origins := map[*StyleDeclaration]string{}
+
+	for _, rules := range []struct {
+		styleRules []*StyleRule
+		origin     string
+	}{
+		{element.styleRules, StylesheetOrigin},
+		{inlineRules, StyleAttributeOrigin},
+		{attrRules, PresentationalAttributeOrigin},
+	} {
+		for _, styleRule := range rules.styleRules {
+			for _, declaration := range styleRule.Declarations {
+				styleDecl := NewStyleDeclaration(styleRule, declaration)
+				candidates = append(candidates, styleDecl)
+				origins[styleDecl] = rules.origin
+			}
+		}
+	}
+
+	// winning declaration of each property, as in mergeStyleDeclarations
+	winners := map[string]*StyleDeclaration{}
+	for _, styleDecl := range candidates {
+		property := styleDecl.Declaration.Property
+		if winners[property] == nil || styleDecl.Specificity() >= winners[property].Specificity() {
+			winners[property] = styleDecl
+		}
+	}
+
+	// the hooks get the winning declarations sorted by property name, as in computeDeclarations
+	hooks := element.hook != nil || element.declarationHook != nil
+	hookDecls := []*StyleDeclaration{}
+	hooked := map[*StyleDeclaration]bool{}
+	if hooks {
+		sorted := []*StyleDeclaration{}
+		for _, styleDecl := range winners {
+			sorted = append(sorted, styleDecl)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].Declaration.Property < sorted[j].Declaration.Property
+		})
+
+		var err error
+		if hookDecls, err = element.applyHooks(sorted); err != nil {
+			return nil, err
+		}
+
+		for _, styleDecl := range hookDecls {
+			hooked[styleDecl] = true
+		}
+	}
+
+	result := []*DeclarationExplanation{}
+
+	for _, styleDecl := range candidates {
+		winner := winners[styleDecl.Declaration.Property]
+
+		explanation := &DeclarationExplanation{
+			Property:    styleDecl.Declaration.Property,
+			Value:       styleDecl.Declaration.Value,
+			Important:   styleDecl.Declaration.Important,
+			Specificity: styleDecl.StyleRule.Specificity,
+			Origin:      origins[styleDecl],
+			Won:         styleDecl == winner,
+		}
+
+		if explanation.Origin == StylesheetOrigin {
+			explanation.Selector = styleDecl.StyleRule.Selector
+			explanation.Source = describeCssSource(styleDecl.StyleRule.Source)
+			if source := styleDecl.StyleRule.Source; source != nil {
+				explanation.Line = source.Line
+				explanation.Column = source.Column
+			}
+		}
+
+		if !explanation.Won {
+			explanation.Reason = lostReason(styleDecl, winner, origins[winner])
+		} else if hooks && !hooked[styleDecl] {
+			explanation.Won = false
+			explanation.Reason = "removed or replaced by a hook"
+		}
+
+		result = append(result, explanation)
+	}
+
+	// declarations added by the hooks
+	for _, styleDecl := range hookDecls {
+		if _, ok := origins[styleDecl]; ok {
+			continue
+		}
+
+		explanation := &DeclarationExplanation{
+			Property:  styleDecl.Declaration.Property,
+			Value:     styleDecl.Declaration.Value,
+			Important: styleDecl.Declaration.Important,
+			Origin:    HookOrigin,
+			Won:       true,
+		}
+		if styleDecl.StyleRule != nil {
+			explanation.Specificity = styleDecl.StyleRule.Specificity
+		}
+
+		result = append(result, explanation)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Property < result[j].Property
+	})
+
+	return result, nil
+}
+
+// lostReason describes why a declaration lost against the winning one.
+func lostReason(styleDecl *StyleDeclaration, winner *StyleDeclaration, winnerOrigin string) string {
+	by := winnerOrigin
+	if winnerOrigin == StylesheetOrigin {
+		by = fmt.Sprintf("`%s`", winner.StyleRule.Selector)
+	}
+
+	switch {
+	case winner.Declaration.Important && !styleDecl.Declaration.Important:
+		return fmt.Sprintf("overridden by the !important declaration of %s", by)
+	case winner.Specificity() > styleDecl.Specificity():
+		return fmt.Sprintf("overridden by %s with a higher specificity (%d > %d)", by, winner.StyleRule.Specificity, styleDecl.StyleRule.Specificity)
+	default:
+		return fmt.Sprintf("overridden by %s declared later with the same specificity", by)
+	}
+}
+
+// describeCssSource returns the path or URL of a stylesheet file, or the kind of the
+// stylesheet, followed by the position of the rule if known.
+func describeCssSource(source *CssSource) string {
+	if source == nil {
+		return ""
+	}
+
+	return source.String()
+}
+
+// describeElement returns a selector-like description of an element (e.g. `p#intro.lead`).
+func describeElement(s *goquery.Selection) string {
+	result := goquery.NodeName(s)
+
+	if id, ok := s.Attr("id"); ok && id != "" {
+		result += "#" + id
+	}
+
+	for _, class := range strings.Fields(s.AttrOr("class", "")) {
+		result += "." + class
+	}
+
+	return result
+}
@@ -0,0 +1,269 @@
+package cssinliner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.baoshuo.dev/cssparser"
+)
+
+func TestExplain(t *testing.T) {
+	source := `<html><head><style>p { color: red; margin: 0; } .lead { color: blue; } p { color: green; }</style></head><body><p id="intro" class="lead" style="margin: 1px;">Hello Explain</p></body></html>`
+
+	explanations, err := Explain(source, "#intro", WithStylesheetsAt(AfterDocumentStyles, `p { padding: 0 !important; }`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(explanations) != 1 {
+		t.Fatalf("Expected 1 explanation, got %d", len(explanations))
+	}
+
+	if explanations[0].Element != "p#intro.lead" {
+		t.Errorf("Expected element p#intro.lead, got %s", explanations[0].Element)
+	}
+
+	expected := []string{
+		"color: red (p, style:1:20): overridden by `.lead` with a higher specificity (10 > 1)",
+		"color: blue (.lead, style:1:49): won",
+		"color: green (p, style:1:72): overridden by `.lead` with a higher specificity (10 > 1)",
+		"margin: 0 (p, style:1:20): overridden by style attribute with a higher specificity (1001 > 1)",
+		"margin: 1px (, ): won",
+		"padding: 0 (p, injected:1:1): won",
+	}
+
+	result := []string{}
+	for _, declaration := range explanations[0].Declarations {
+		status := "won"
+		if !declaration.Won {
+			status = declaration.Reason
+		}
+
+		result = append(result, declaration.Property+": "+declaration.Value+" ("+declaration.Selector+", "+declaration.Source+"): "+status)
+	}
+
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %s, got %s", strings.Join(expected, "\n"), strings.Join(result, "\n"))
+	}
+}
+
+func TestExplainLaterRule(t *testing.T) {
+	source := `<html><head><style>p { color: red; } p { color: blue !important; } p { color: green; }</style></head><body><p>Hello</p></body></html>`
+
+	explanations, err := Explain(source, "p")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	declarations := explanations[0].Declarations
+	if len(declarations) != 3 || !declarations[1].Won {
+		t.Fatalf("Expected the !important declaration to win, got %v", declarations)
+	}
+
+	expected := "overridden by the !important declaration of `p`"
+	if declarations[2].Reason != expected {
+		t.Errorf("Expected %s, got %s", expected, declarations[2].Reason)
+	}
+}
+
+func TestExplainNode(t *testing.T) {
+	source := `<html><head><style>p { color: red; } .lead { color: blue; }</style></head><body><p class="lead">Hello</p><p id="other">Other</p></body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	before, _ := doc.Html()
+
+	explanation, err := ExplainNode(doc.Find(".lead").Nodes[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if explanation.Element != "p.lead" {
+		t.Errorf("Expected element p.lead, got %s", explanation.Element)
+	}
+
+	if len(explanation.Declarations) != 2 || explanation.Declarations[0].Won || !explanation.Declarations[1].Won {
+		t.Errorf("Expected the .lead declaration to win, got %v", explanation.Declarations)
+	}
+
+	if after, _ := doc.Html(); after != before {
+		t.Errorf("Expected the document to be left untouched, got %s", after)
+	}
+
+	if _, err := ExplainNode(doc.Find("p").Nodes[0].FirstChild); err == nil {
+		t.Errorf("Expected an error for a text node")
+	}
+}
+
+func TestExplainWithHooks(t *testing.T) {
+	source := `<html><head><style>p { color: red; margin: 0; line-height: 20px; }</style></head><body><p>Hello</p></body></html>`
+
+	explanations, err := Explain(source, "p",
+		WithDeclarationHook(func(element *goquery.Selection, styleDecl *StyleDeclaration) (*StyleDeclaration, error) {
+			if styleDecl.Declaration.Property == "margin" {
+				return nil, nil
+			}
+
+			return styleDecl, nil
+		}),
+		WithElementHook(func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+			return append(declarations, &StyleDeclaration{
+				Declaration: &cssparser.Declaration{Property: "mso-line-height-rule", Value: "exactly"},
+			}), nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{
+		"color: red (stylesheet): won",
+		"line-height: 20px (stylesheet): won",
+		"margin: 0 (stylesheet): removed or replaced by a hook",
+		"mso-line-height-rule: exactly (hook): won",
+	}
+
+	result := []string{}
+	for _, declaration := range explanations[0].Declarations {
+		status := "won"
+		if !declaration.Won {
+			status = declaration.Reason
+		}
+
+		result = append(result, declaration.Property+": "+declaration.Value+" ("+declaration.Origin+"): "+status)
+	}
+
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %s, got %s", strings.Join(expected, "\n"), strings.Join(result, "\n"))
+	}
+}
+
+func TestInlinerReuse(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello</p></body></html>`
+
+	inliner := NewInliner(source)
+	if _, err := inliner.Explain("p"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := inliner.Inline(); err == nil {
+		t.Errorf("Expected an error when inlining with an inliner already used by Explain")
+	}
+
+	inliner = NewInliner(source)
+	if _, err := inliner.Inline(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := inliner.Inline(); err == nil {
+		t.Errorf("Expected an error when inlining twice with the same inliner")
+	}
+}
+
+func TestExplainInvalidSelector(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello</p></body></html>`
+
+	if _, err := Explain(source, "p["); err == nil {
+		t.Errorf("Expected an error for an invalid selector")
+	}
+}
+
+func TestInlineRuleSources(t *testing.T) {
+	source := `<html>
+<head><style>
+/* { comment } */
+p { color: red; }
+@media print {
+  p { color: black; }
+}
+/* é */ .lead,
+  .intro { content: "}"; margin: 0; }
+</style></head><body><p class="lead">Hello</p></body></html>`
+
+	// positions are in the source document, before preprocessing
+	preprocessor := func(css string, source *CssSource) (string, error) {
+		return "\n\n" + css, nil
+	}
+
+	explanations, err := Explain(source, "p", WithCssPreprocessor(preprocessor, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"p 4:1", ".lead 8:9", ".lead 8:9"}
+
+	result := []string{}
+	for _, declaration := range explanations[0].Declarations {
+		result = append(result, fmt.Sprintf("%s %d:%d", declaration.Selector, declaration.Line, declaration.Column))
+	}
+
+	if strings.Join(result, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected %s, got %s", strings.Join(expected, ", "), strings.Join(result, ", "))
+	}
+}
+
+func TestInlineReaderRuleSources(t *testing.T) {
+	source := "<html>\n<head><style>\n  p { color: red; }\n</style></head><body><p>Hello</p></body></html>"
+
+	positions := []string{}
+	hook := WithElementHook(func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		for _, styleDecl := range declarations {
+			positions = append(positions, fmt.Sprintf("%d:%d", styleDecl.StyleRule.Source.Line, styleDecl.StyleRule.Source.Column))
+		}
+
+		return declarations, nil
+	})
+
+	// the streamed document is kept to locate the rules
+	var result strings.Builder
+	if err := InlineReader(context.Background(), strings.NewReader(source), &result, hook); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// an already parsed document has no source, so the positions are unknown
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := InlineDocument(doc, hook); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []string{"3:3", "0:0"}
+	if strings.Join(positions, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected %s, got %s", strings.Join(expected, ", "), strings.Join(positions, ", "))
+	}
+}
+
+func TestInlineLocalFileRuleSources(t *testing.T) {
+	tempDir := t.TempDir()
+	cssPath := filepath.Join(tempDir, "style.css")
+	if err := os.WriteFile(cssPath, []byte("a { color: red; }\n\n  p { color: blue; }"), 0644); err != nil {
+		t.Fatalf("Failed to write stylesheet: %v", err)
+	}
+
+	source := `<html><head><link rel="stylesheet" href="style.css" /></head><body><p>Hello</p></body></html>`
+
+	explanations, err := Explain(source, "p",
+		WithAllowReadLocalFiles(true, filepath.Join(tempDir, "index.html")),
+		WithCssFilePreprocessor(func(css, path string) (string, error) {
+			return "\n" + strings.ReplaceAll(css, "\n", ""), nil
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := cssPath + ":3:3"
+	if source := explanations[0].Declarations[0].Source; source != expected {
+		t.Errorf("Expected %s, got %s", expected, source)
+	}
+}
@@ -4,11 +4,11 @@ go 1.25.0
 
 require (
 	github.com/PuerkitoBio/goquery v1.10.3
+	github.com/andybalholm/cascadia v1.3.3
 	go.baoshuo.dev/cssparser v0.0.9
 	golang.org/x/net v0.55.0
 )
 
 require (
-	github.com/andybalholm/cascadia v1.3.3 // indirect
 	github.com/tdewolff/parse/v2 v2.8.1 // indirect
 )
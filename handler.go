@@ -0,0 +1,140 @@
+package cssinliner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultMaxBodyBytes is the maximum size of request bodies used when the handler
+// doesn't set one.
+const DefaultMaxBodyBytes = 10 << 20
+
+// Handler is an HTTP handler exposing the inliner as an API.
+//
+// It accepts POST requests with either an HTML document as body, or a JSON body with
+// the `html`, the optional additional `css` and the optional `fragment` context
+// element. It responds with a JSON body holding the inlined `html` and the `report`
+// of the inlining, or an `error`.
+//
+// NOTE: Once a request is canceled or timed out, its inlining stops at the next rule
+// or element, and its remote stylesheets fetches are canceled.
+type Handler struct {
+	Options      []InlinerOption // Options applied to every request
+	MaxBodyBytes int64           // Maximum size of request bodies, DefaultMaxBodyBytes if zero
+	Timeout      time.Duration   // Maximum duration of the inlining of a request, unlimited if zero
+}
+
+// HandlerRequest is the JSON body of requests to the handler.
+type HandlerRequest struct {
+	HTML     string `json:"html"`               // The HTML document or fragment
+	CSS      string `json:"css,omitempty"`      // CSS inlined in addition to the stylesheets of the document
+	Fragment string `json:"fragment,omitempty"` // Context element to parse the HTML as a fragment in
+}
+
+// HandlerResponse is the JSON body of responses of the handler.
+type HandlerResponse struct {
+	HTML   string  `json:"html,omitempty"`   // The inlined HTML
+	Report *Report `json:"report,omitempty"` // Information collected while inlining
+	Error  string  `json:"error,omitempty"`  // Description of the error, if the request failed
+}
+
+func (handler *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeHandlerResponse(w, http.StatusMethodNotAllowed, &HandlerResponse{Error: "method not allowed"})
+		return
+	}
+
+	maxBodyBytes := handler.MaxBodyBytes
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+
+	request, err := readHandlerRequest(r, http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		status := http.StatusBadRequest
+		if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		writeHandlerResponse(w, status, &HandlerResponse{Error: err.Error()})
+		return
+	}
+
+	ctx := r.Context()
+	if handler.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, handler.Timeout)
+		defer cancel()
+	}
+
+	response := &HandlerResponse{Report: &Report{}}
+	done := make(chan error, 1)
+
+	go func() {
+		var result strings.Builder
+
+		options := append(slices.Clip(handler.Options), WithReport(response.Report))
+		if request.Fragment != "" {
+			options = append(options, WithFragmentContext(request.Fragment))
+		}
+		if request.CSS != "" {
+			options = append(options, WithStylesheets(request.CSS))
+		}
+
+		err := InlineReader(ctx, strings.NewReader(request.HTML), &result, options...)
+		response.HTML = result.String()
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeHandlerResponse(w, http.StatusGatewayTimeout, &HandlerResponse{Error: "inlining timed out"})
+	case err != nil:
+		writeHandlerResponse(w, http.StatusUnprocessableEntity, &HandlerResponse{Error: err.Error()})
+	default:
+		writeHandlerResponse(w, http.StatusOK, response)
+	}
+}
+
+// readHandlerRequest reads the HTML document, or the JSON request, of the body.
+func readHandlerRequest(r *http.Request, body io.Reader) (*HandlerRequest, error) {
+	request := &HandlerRequest{}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.NewDecoder(body).Decode(request); err != nil {
+			return nil, err
+		}
+
+		return request, nil
+	}
+
+	html, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	request.HTML = string(html)
+
+	return request, nil
+}
+
+func writeHandlerResponse(w http.ResponseWriter, status int, response *HandlerResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,85 @@
+package cssinliner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveHandler(t *testing.T, handler *Handler, method, contentType, body string) (int, *HandlerResponse) {
+	t.Helper()
+
+	request := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	response := &HandlerResponse{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	return recorder.Code, response
+}
+
+func TestHandlerHTML(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello Handler</p></body></html>`
+	expected := `<html><head></head><body><p style="color:red">Hello Handler</p></body></html>`
+
+	status, response := serveHandler(t, &Handler{Options: []InlinerOption{WithMinify(true)}}, http.MethodPost, "text/html", source)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, response.Error)
+	}
+
+	if response.HTML != expected {
+		t.Errorf("Expected %s, got %s", expected, response.HTML)
+	}
+	if response.Report == nil {
+		t.Errorf("Expected a report")
+	}
+}
+
+func TestHandlerJSON(t *testing.T) {
+	body := `{"html": "<p>Hello Fragment</p>", "css": "p { color: blue; }", "fragment": "body"}`
+	expected := `<p style="color: blue;">Hello Fragment</p>`
+
+	status, response := serveHandler(t, &Handler{}, http.MethodPost, "application/json", body)
+	if status != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, status, response.Error)
+	}
+
+	if response.HTML != expected {
+		t.Errorf("Expected %s, got %s", expected, response.HTML)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	tests := []struct {
+		handler     *Handler
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{&Handler{}, http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{&Handler{}, http.MethodPost, "application/json", "{", http.StatusBadRequest},
+		{&Handler{MaxBodyBytes: 8}, http.MethodPost, "text/html", "<p>Too large</p>", http.StatusRequestEntityTooLarge},
+		{&Handler{Timeout: time.Nanosecond}, http.MethodPost, "text/html", "<p>Timeout</p>", http.StatusGatewayTimeout},
+	}
+
+	for _, test := range tests {
+		status, response := serveHandler(t, test.handler, test.method, test.contentType, test.body)
+		if status != test.status {
+			t.Errorf("Expected status %d for %s %q, got %d", test.status, test.method, test.body, status)
+		}
+		if response.Error == "" {
+			t.Errorf("Expected an error for %s %q", test.method, test.body)
+		}
+	}
+}
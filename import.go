@@ -0,0 +1,81 @@
+package cssinliner
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	cssparser "go.baoshuo.dev/cssparser"
+)
+
+// addLocalImports adds the local stylesheets imported by `@import` rules, and the
+// ones they import, to the local files of the report, resolved from the given
+// directory. The rules are kept as is.
+//
+// The files being imported are passed to detect circular imports.
+func (inliner *Inliner) addLocalImports(css string, dir string, importing []string) {
+	stylesheet, err := cssparser.ParseStylesheet(css, inliner.parserOptions...)
+	if err != nil {
+		return
+	}
+
+	for _, rule := range stylesheet.Rules {
+		if rule.Kind != cssparser.AtRule || !strings.EqualFold(rule.Name, "@import") {
+			continue
+		}
+
+		href := importURL(rule.Prelude)
+		if parsedUrl, err := url.Parse(href); href == "" || err != nil || parsedUrl.IsAbs() {
+			continue // Skip if the URL is not a relative path
+		}
+
+		cssPath := filepath.Join(dir, href)
+		if slices.Contains(importing, cssPath) {
+			continue
+		}
+
+		inliner.report.addLocalFile(cssPath)
+
+		if cssBytes, err := os.ReadFile(cssPath); err == nil {
+			inliner.addLocalImports(string(cssBytes), filepath.Dir(cssPath), append(importing, cssPath))
+		}
+	}
+}
+
+// importURL returns the URL of an `@import` rule prelude, either in `url()` or as a string.
+func importURL(prelude string) string {
+	prelude = strings.TrimSpace(prelude)
+
+	if len(prelude) > 4 && strings.EqualFold(prelude[:4], "url(") {
+		end := strings.IndexByte(prelude, ')')
+		if end < 0 {
+			return ""
+		}
+
+		return strings.Trim(strings.TrimSpace(prelude[4:end]), `"'`)
+	}
+
+	if prelude != "" && (prelude[0] == '"' || prelude[0] == '\'') {
+		end := skipSelectorString(prelude, 0)
+		if end >= len(prelude) {
+			return ""
+		}
+
+		return unescapeCssString(prelude[1:end])
+	}
+
+	return ""
+}
+
+// addStyleElementImports adds the local stylesheets imported by the <style> elements
+// of the document, relatively to the HTML file.
+func (inliner *Inliner) addStyleElementImports(dir string) {
+	inliner.doc.Find("style").Each(func(i int, s *goquery.Selection) {
+		if inlinerDirective(s) != inlinerIgnore {
+			inliner.addLocalImports(s.Text(), dir, nil)
+		}
+	})
+}
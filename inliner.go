@@ -1,6 +1,8 @@
 package cssinliner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,30 +15,80 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	cssparser "go.baoshuo.dev/cssparser"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-const elementMarkerAttr = "data-inliner-marker"
+const (
+	elementMarkerAttr = "data-inliner-marker"
+
+	// Attribute used to opt <style>, <link> and other elements out of inlining:
+	// - `ignore` keeps <style> and <link> elements as is, and prevents other
+	//   elements from receiving inlined styles, the rules matching them being kept
+	//   in the output stylesheet.
+	// - `keep` inlines the rules of <style> and <link> elements but also keeps them
+	//   as is in the output document.
+	inlinerAttr   = "data-inliner"
+	inlinerIgnore = "ignore"
+	inlinerKeep   = "keep"
+)
 
 type Inliner struct {
-	html          string                  // Raw HTML content
-	path          string                  // Path to the HTML file
-	doc           *goquery.Document       // Parsed HTML document
-	stylesheets   []*cssparser.Stylesheet // Parsed CSS stylesheets
-	elements      map[string]*Element     // HTML elements matching collected inlinable style rules
-	rawRules      []fmt.Stringer          // CSS rules that are not inlinable but that must be inserted in output document
-	elementMarker int                     // current element marker value
-
-	parserOptions              []cssparser.ParserOption // CSS parser options
-	allowLoadRemoteStylesheets bool                     // Whether to allow remote content (e.g., <link rel="stylesheet" href="http://example.com/style.css" />)
-	allowReadLocalFiles        bool                     // Whether to allow local files (e.g., <link rel="stylesheet" href="/path/to/local/file.css" />)
-	htmlPreprocessor           HtmlPreprocessor         // Optional HTML preprocessor function to modify HTML before processing
-	cssFilePreprocessor        CssFilePreprocessor      // Optional CSS preprocessor function to modify CSS before inlining
+	ctx           context.Context     // Context of the current inlining
+	html          string              // Raw HTML content
+	source        string              // Raw HTML content before preprocessing, to locate the rules of its <style> elements
+	path          string              // Path to the HTML file
+	doc           *goquery.Document   // Parsed HTML document
+	stylesheets   []*styleSheet       // Parsed CSS stylesheets
+	elements      map[string]*Element // HTML elements matching collected inlinable style rules
+	elementMarker int                 // current element marker value
+
+	temporaryStyleNodes    map[*html.Node]bool            // <style> elements only created to inline CSS (e.g. of kept <link> elements)
+	styleNodeSources       map[*html.Node]*CssSource      // Sources of the CSS of the <style> elements created from <link> elements
+	styleNodePositions     map[*html.Node][]cssPosition   // Positions of the rules of the <style> elements in their source document or file
+	lastHeadStyleNode      *html.Node                     // Last <style> element inserted at the start of the head or of a fragment
+	pseudoClassRules       []*StyleRule                   // CSS rules using dynamic pseudo-classes, inserted in a dedicated <style> element
+	pseudoElementRules     []*pseudoElementRule           // ::before and ::after rules materialized into real elements
+	inlinedPropertiesCache map[*html.Node]map[string]bool // Properties inlined in the style attribute of elements
+	report                 *Report                        // Information collected while inlining
+
+	parserOptions              []cssparser.ParserOption   // CSS parser options
+	allowLoadRemoteStylesheets bool                       // Whether to allow remote content (e.g., <link rel="stylesheet" href="http://example.com/style.css" />)
+	allowReadLocalFiles        bool                       // Whether to allow local files (e.g., <link rel="stylesheet" href="/path/to/local/file.css" />)
+	htmlPreprocessor           HtmlPreprocessor           // Optional HTML preprocessor function to modify HTML before processing
+	cssFilePreprocessor        CssFilePreprocessor        // Optional CSS preprocessor function to modify CSS before inlining
+	cssPreprocessor            CssPreprocessor            // Optional CSS preprocessor function applied to every CSS source
+	preprocessStyleAttrs       bool                       // Whether to apply the CSS preprocessor to style attributes
+	attributeMappings          []*AttributeMapping        // Presentational attributes converted into CSS declarations
+	emitAttributes             bool                       // Whether to write presentational attributes from inlined CSS declarations
+	presentationalAttributes   []*PresentationalAttribute // CSS declarations written back as presentational attributes
+	keepStylePositions         bool                       // Whether to keep non-inlinable rules in their original <style> elements
+	pseudoClassStyles          bool                       // Whether to insert the rules using dynamic pseudo-classes in a dedicated <style> element
+	pseudoClassTarget          string                     // Selector of the element receiving the dedicated <style> element
+	materializePseudoElements  bool                       // Whether to materialize ::before and ::after pseudo-elements into real elements
+	removeUnusedCSS            bool                       // Whether to remove the non-inlinable rules matching no element
+	removeUnusedClassesAndIDs  bool                       // Whether to remove the classes and ids not referenced by the output stylesheets
+	keptClassesAndIDs          []string                   // Classes and ids kept even if not referenced by the output stylesheets
+	minify                     bool                       // Whether to minify the output stylesheets and style attributes
+	outputOptions              *OutputOptions             // Optional options controlling the serialization of the output document
+	elementHook                ElementHook                // Optional hook modifying the winning declarations of each element
+	declarationHook            DeclarationHook            // Optional hook modifying each winning declaration of each element
+	fragmentContext            string                     // Tag name of the context element to parse the HTML content as a fragment in
+	extraStylesheets           []*extraStylesheet         // Stylesheets supplied programmatically, in addition to the ones of the document
+	placeholders               *placeholders              // Optional template placeholders masked during processing
+	used                       bool                       // Whether the document has already been processed
 }
 
+// errInlinerUsed is returned when an inliner processes its document a second time.
+var errInlinerUsed = errors.New("the inliner has already processed its document, create a new one")
+
 func NewInliner(html string, options ...InlinerOption) *Inliner {
 	inliner := &Inliner{
-		html:     html,
-		elements: make(map[string]*Element),
+		html:                     html,
+		elements:                 make(map[string]*Element),
+		attributeMappings:        defaultAttributeMappings,
+		presentationalAttributes: defaultPresentationalAttributes,
+		pseudoClassStyles:        true,
+		report:                   &Report{},
 	}
 
 	for _, option := range options {
@@ -65,60 +117,234 @@ func InlineFile(path string, options ...InlinerOption) (string, error) {
 	return NewInliner(string(html), append(options, WithAllowReadLocalFiles(true, path))...).Inline()
 }
 
+// InlineFragment inlines the given CSS, along with the fragment's own stylesheets,
+// into an HTML fragment parsed in a <body> context, unless another context is set
+// with WithFragmentContext.
+func InlineFragment(fragment string, css string, options ...InlinerOption) (string, error) {
+	options = append([]InlinerOption{WithFragmentContext("body"), WithStylesheets(css)}, options...)
+
+	return NewInliner(fragment, options...).Inline()
+}
+
+// InlineReader reads an HTML document from r, inlines the CSS styles into it and
+// writes the result to w.
+//
+// NOTE: The whole document is read in memory before parsing when an HTML preprocessor
+// is provided, or when the output options need the source document.
+func InlineReader(ctx context.Context, r io.Reader, w io.Writer, options ...InlinerOption) error {
+	return NewInliner("", options...).inline(ctx, r, w)
+}
+
+// InlineDocument inlines the CSS styles into an already parsed document, in place.
+//
+// NOTE: The document is not serialized, so the output options don't apply, and the
+// ones needing the source document (PreserveDoctype and PreserveEntities) are rejected.
+// Without the source document, the rules of its <style> elements are reported with an
+// unknown position (line and column 0).
+func InlineDocument(doc *goquery.Document, options ...InlinerOption) error {
+	inliner := NewInliner("", options...)
+	if inliner.outputOptions.needsSource() {
+		return errors.New("the PreserveDoctype and PreserveEntities output options need the source document")
+	}
+
+	inliner.ctx = context.Background()
+	inliner.doc = doc
+
+	return inliner.process()
+}
+
+// InlineNode inlines the CSS styles into the tree rooted at the given node, in place,
+// including the node itself. The non-inlinable rules are inserted into the head of the
+// document holding the node, or at the start of the node if it's detached.
+//
+// NOTE: As with InlineDocument, the rules of the <style> elements have an unknown position.
+func InlineNode(node *html.Node, options ...InlinerOption) error {
+	return InlineDocument(goquery.NewDocumentFromNode(node), options...)
+}
+
+// Inline returns the HTML content of the inliner with the CSS styles inlined.
+//
+// NOTE: An inliner processes its document in place, so it can only be used once, either
+// by Inline or by Explain.
 func (inliner *Inliner) Inline() (string, error) {
+	var result strings.Builder
+
+	if err := inliner.inline(context.Background(), nil, &result); err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// inline processes the HTML document read from r, or the raw HTML content if r is nil,
+// and writes the result to w.
+func (inliner *Inliner) inline(ctx context.Context, r io.Reader, w io.Writer) error {
+	if inliner.used {
+		return errInlinerUsed
+	}
+	inliner.used = true
+
+	inliner.ctx = ctx
+
+	// The raw HTML content is required to preprocess it, to mask placeholders or to preserve parts of it
+	if r != nil && (inliner.htmlPreprocessor != nil || inliner.placeholders != nil || inliner.outputOptions.needsSource()) {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read HTML: %w", err)
+		}
+
+		inliner.html = string(content)
+		r = nil
+	}
+
+	// The streamed document is kept as it's read, to locate the rules of its <style> elements
+	var source strings.Builder
+	if r == nil {
+		if err := inliner.prepareHTML(); err != nil {
+			return err
+		}
+
+		r = strings.NewReader(inliner.html)
+	} else {
+		r = io.TeeReader(r, &source)
+	}
+
+	// Step 1: Parse the HTML document
+	if err := inliner.parseHTML(r); err != nil {
+		return err
+	}
+	if source.Len() > 0 {
+		inliner.source = source.String()
+	}
+
+	// Steps 2 to 6: Inline the styles into the document
+	if err := inliner.process(); err != nil {
+		return err
+	}
+
+	// Step 7: Generate the final HTML output
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return inliner.genHTML(w)
+}
+
+// prepareHTML preprocesses the raw HTML content before parsing.
+func (inliner *Inliner) prepareHTML() error {
+	inliner.source = inliner.html
+
 	// If an HTML preprocessor is provided, apply it to the HTML content
 	if inliner.htmlPreprocessor != nil {
 		processedHTML, err := inliner.htmlPreprocessor(inliner.html, inliner.path)
 		if err != nil {
-			return "", fmt.Errorf("failed to preprocess HTML: %w", err)
+			return fmt.Errorf("failed to preprocess HTML: %w", err)
 		}
 		inliner.html = processedHTML
 	}
 
-	// Step 1: Parse the HTML document
-	if err := inliner.parseHTML(); err != nil {
-		return "", err
+	// Template placeholders are masked so that they are not escaped nor parsed as CSS
+	if inliner.placeholders != nil {
+		inliner.html = inliner.placeholders.mask(inliner.html)
+	}
+
+	return nil
+}
+
+// process inlines the styles into the parsed document.
+func (inliner *Inliner) process() error {
+	// Steps 2 to 4: Load and parse the stylesheets, and collect the elements to style
+	if err := inliner.collect(); err != nil {
+		return err
+	}
+
+	// Step 5: Inline style rules into elements
+	if err := inliner.inlineStyleRules(); err != nil {
+		return err
+	}
+	if inliner.emitAttributes {
+		inliner.setTableAttributes()
+	}
+
+	// Step 6: Materialize pseudo-elements and compute raw CSS rules that are not inlinable
+	inliner.insertPseudoElements()
+	if err := inliner.insertRawStylesheet(); err != nil {
+		return err
+	}
+	if err := inliner.insertPseudoClassStylesheet(); err != nil {
+		return err
 	}
 
+	inliner.stripUnusedClassesAndIDs()
+	inliner.removeInlinerAttributes()
+
+	return nil
+}
+
+// collect loads and parses the stylesheets, and collects the elements and the rules
+// applying to them.
+func (inliner *Inliner) collect() error {
 	// Step 2: Fetch remote stylesheets and load local stylesheets if allowed
 	if inliner.allowLoadRemoteStylesheets {
 		if err := inliner.fetchRemoteStylesheets(); err != nil {
-			return "", fmt.Errorf("failed to fetch external stylesheets: %w", err)
+			return fmt.Errorf("failed to fetch external stylesheets: %w", err)
 		}
 	}
 	if inliner.allowReadLocalFiles {
 		if err := inliner.loadLocalStylesheet(); err != nil {
-			return "", fmt.Errorf("failed to load local stylesheets: %w", err)
+			return fmt.Errorf("failed to load local stylesheets: %w", err)
 		}
 	}
 
 	// Step 3: Parse stylesheets from the document
+	if err := inliner.ctx.Err(); err != nil {
+		return err
+	}
+	if err := inliner.preprocessStyleAttributes(); err != nil {
+		return fmt.Errorf("failed to preprocess style attribute: %w", err)
+	}
 	if err := inliner.parseStylesheets(); err != nil {
-		return "", err
+		return err
 	}
 
 	// Step 4: Collect elements and rules
-	inliner.collectElementsAndRules()
+	return inliner.collectElementsAndRules()
+}
 
-	// Step 5: Inline style rules into elements
-	if err := inliner.inlineStyleRules(); err != nil {
-		return "", err
+func (inliner *Inliner) parseHTML(r io.Reader) error {
+	if inliner.fragmentContext != "" {
+		return inliner.parseFragment(r)
 	}
 
-	// Step 6: Compute raw CSS rules that are not inlinable
-	inliner.insertRawStylesheet()
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return err
+	}
 
-	// Step 7: Generate the final HTML output
-	return inliner.genHTML()
+	inliner.doc = doc
+
+	return nil
 }
 
-func (inliner *Inliner) parseHTML() error {
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(inliner.html))
+// parseFragment parses the HTML content as a fragment in the context element, whose
+// synthetic node becomes the root of the document.
+func (inliner *Inliner) parseFragment(r io.Reader) error {
+	root := &html.Node{
+		Type:     html.ElementNode,
+		Data:     inliner.fragmentContext,
+		DataAtom: atom.Lookup([]byte(inliner.fragmentContext)),
+	}
+
+	nodes, err := html.ParseFragment(r, root)
 	if err != nil {
 		return err
 	}
 
-	inliner.doc = doc
+	for _, node := range nodes {
+		root.AppendChild(node)
+	}
+
+	inliner.doc = goquery.NewDocumentFromNode(root)
 
 	return nil
 }
@@ -126,7 +352,7 @@ func (inliner *Inliner) parseHTML() error {
 func (inliner *Inliner) fetchRemoteStylesheets() error {
 	inliner.doc.Find("link[rel='stylesheet']").Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
-		if !exists {
+		if !exists || inlinerDirective(s) == inlinerIgnore {
 			return
 		}
 
@@ -134,30 +360,38 @@ func (inliner *Inliner) fetchRemoteStylesheets() error {
 			return
 		}
 
-		resp, err := http.Get(href)
+		req, err := http.NewRequestWithContext(inliner.ctx, http.MethodGet, href, nil)
 		if err != nil {
+			inliner.report.addDiagnostic(href, "failed to fetch stylesheet: %v", err)
+			return
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			inliner.report.addDiagnostic(href, "failed to fetch stylesheet: %v", err)
 			return
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode >= http.StatusBadRequest {
+			inliner.report.addDiagnostic(href, "failed to fetch stylesheet: %s", resp.Status)
+			return
+		}
+
 		cssBytes, err := io.ReadAll(resp.Body)
 		if err != nil {
+			inliner.report.addDiagnostic(href, "failed to read stylesheet: %v", err)
 			return
 		}
 
-		var css string
-		if inliner.cssFilePreprocessor != nil {
-			processedCss, err := inliner.cssFilePreprocessor(string(css), href)
-			if err != nil {
-				return
-			}
-			css = processedCss
-		} else {
-			css = string(cssBytes)
+		source := &CssSource{Kind: RemoteFileSource, Path: href, Element: s}
+
+		css, ok := inliner.preprocessCssFile(string(cssBytes), source)
+		if !ok {
+			return
 		}
 
-		style := fmt.Sprintf("<style>%s</style>", css)
-		s.ReplaceWithHtml(style)
+		inliner.replaceLinkedStylesheet(s, css, source, string(cssBytes))
 	})
 
 	return nil
@@ -170,45 +404,151 @@ func (inliner *Inliner) loadLocalStylesheet() error {
 
 	dir := filepath.Dir(inliner.path)
 
+	inliner.addStyleElementImports(dir)
+
 	inliner.doc.Find("link[rel='stylesheet']").Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
 		if !exists {
 			return // Skip if href attribute is not present
 		}
 
+		if inlinerDirective(s) == inlinerIgnore {
+			return // Skip if the stylesheet is opted out of inlining
+		}
+
 		if parsedUrl, err := url.Parse(href); err != nil || parsedUrl.IsAbs() {
 			return // Skip if the href is not a relative path, meaning it's not a local file
 		}
 
 		cssPath := filepath.Join(dir, href)
+		inliner.report.addLocalFile(cssPath)
+
 		cssBytes, err := os.ReadFile(cssPath)
 		if err != nil {
+			inliner.report.addDiagnostic(cssPath, "failed to read stylesheet: %v", err)
 			return
 		}
 
-		var css string
-		if inliner.cssFilePreprocessor != nil {
-			processedCss, err := inliner.cssFilePreprocessor(string(cssBytes), cssPath)
-			if err != nil {
-				return
-			}
-			css = processedCss
-		} else {
-			css = string(cssBytes)
+		source := &CssSource{Kind: LocalFileSource, Path: cssPath, Element: s}
+
+		inliner.addLocalImports(string(cssBytes), filepath.Dir(cssPath), []string{cssPath})
+
+		css, ok := inliner.preprocessCssFile(string(cssBytes), source)
+		if !ok {
+			return
 		}
 
-		style := fmt.Sprintf("<style>%s</style>", css)
-		s.ReplaceWithHtml(style)
+		inliner.replaceLinkedStylesheet(s, css, source, string(cssBytes))
 	})
 
 	return nil
 }
 
+// replaceLinkedStylesheet replaces a <link> element with a <style> element holding its
+// preprocessed CSS, whose rules are located in the original CSS of the file.
+// Kept <link> elements stay in the document, and the <style> element is only used
+// to inline their rules.
+func (inliner *Inliner) replaceLinkedStylesheet(link *goquery.Selection, css string, source *CssSource, original string) {
+	styleNode := newLinkedStyleNode(css, link)
+	inliner.setStyleNodeSource(styleNode, source)
+	inliner.setStyleNodePositions(styleNode, findRulePositions(original))
+
+	if inlinerDirective(link) == inlinerKeep {
+		inliner.addTemporaryStyleNode(styleNode)
+		link.BeforeNodes(styleNode)
+		return
+	}
+
+	link.ReplaceWithNodes(styleNode)
+}
+
+// addTemporaryStyleNode marks a <style> element to be removed once parsed.
+func (inliner *Inliner) addTemporaryStyleNode(styleNode *html.Node) {
+	if inliner.temporaryStyleNodes == nil {
+		inliner.temporaryStyleNodes = make(map[*html.Node]bool)
+	}
+
+	inliner.temporaryStyleNodes[styleNode] = true
+}
+
 func (inliner *Inliner) parseStylesheets() error {
+	if err := inliner.parseExtraStylesheets(BeforeDocumentStyles); err != nil {
+		return err
+	}
+
+	if err := inliner.parseDocumentStylesheets(); err != nil {
+		return err
+	}
+
+	return inliner.parseExtraStylesheets(AfterDocumentStyles)
+}
+
+// parseExtraStylesheets parses the stylesheets supplied programmatically at the given position.
+func (inliner *Inliner) parseExtraStylesheets(position StylesheetPosition) error {
+	for _, extra := range inliner.extraStylesheets {
+		if extra.position != position {
+			continue
+		}
+
+		stylesheet := extra.stylesheet
+		css := ""
+		if stylesheet == nil {
+			var err error
+			if css, err = inliner.preprocessCss(extra.css, &CssSource{Kind: InjectedSource}); err != nil {
+				return fmt.Errorf("failed to preprocess stylesheet: %w", err)
+			}
+
+			if stylesheet, err = cssparser.ParseStylesheet(css, inliner.parserOptions...); err != nil {
+				return err
+			}
+		}
+
+		if stylesheet == nil {
+			continue
+		}
+
+		sheet := newStyleSheet(stylesheet, nil)
+		sheet.position = position
+		sheet.source = &CssSource{Kind: InjectedSource}
+		if extra.stylesheet == nil {
+			sheet.locateRules(findRulePositions(extra.css))
+		}
+		inliner.stylesheets = append(inliner.stylesheets, sheet)
+	}
+
+	return nil
+}
+
+func (inliner *Inliner) parseDocumentStylesheets() error {
 	var result error
 
+	inliner.locateStyleElementRules()
+
 	inliner.doc.Find("style").EachWithBreak(func(i int, s *goquery.Selection) bool {
-		stylesheet, err := cssparser.ParseStylesheet(s.Text(), inliner.parserOptions...)
+		directive := inlinerDirective(s)
+		if directive == inlinerIgnore {
+			return true
+		}
+
+		// the CSS of <style> elements created from <link> elements is already preprocessed
+		css := s.Text()
+		source := inliner.styleNodeSources[s.Nodes[0]]
+		if source == nil {
+			source = &CssSource{Kind: StyleElementSource, Element: s}
+
+			var err error
+			if css, err = inliner.preprocessCss(css, source); err != nil {
+				result = fmt.Errorf("failed to preprocess stylesheet: %w", err)
+				return false
+			}
+
+			// kept elements are output with the preprocessed CSS too
+			if directive == inlinerKeep && css != s.Text() {
+				setStyleText(s, css)
+			}
+		}
+
+		stylesheet, err := cssparser.ParseStylesheet(css, inliner.parserOptions...)
 		if err != nil {
 			result = err
 			return false
@@ -218,10 +558,18 @@ func (inliner *Inliner) parseStylesheets() error {
 			return true
 		}
 
-		inliner.stylesheets = append(inliner.stylesheets, stylesheet)
-
-		// removes parsed stylesheet
-		s.Remove()
+		sheet := newStyleSheet(stylesheet, s)
+		sheet.keep = directive == inlinerKeep
+		sheet.source = source
+		sheet.locateRules(inliner.styleNodePositions[s.Nodes[0]])
+		inliner.stylesheets = append(inliner.stylesheets, sheet)
+
+		if inliner.temporaryStyleNodes[s.Nodes[0]] {
+			s.Remove()
+		} else if !inliner.keepStylePositions && !sheet.keep {
+			// removes parsed stylesheet, unless it's kept to hold the non-inlinable rules
+			s.Remove()
+		}
 
 		return true
 	})
@@ -229,46 +577,153 @@ func (inliner *Inliner) parseStylesheets() error {
 	return result
 }
 
-func (inliner *Inliner) collectElementsAndRules() {
-	for _, stylesheet := range inliner.stylesheets {
-		for _, rule := range stylesheet.Rules {
+// locateStyleElementRules records the positions of the rules of the <style> elements in
+// the source document, when it's available and holds the same <style> elements.
+func (inliner *Inliner) locateStyleElementRules() {
+	if inliner.source == "" {
+		return
+	}
+
+	styleNodes := []*html.Node{}
+	for _, node := range inliner.doc.Find("style").Nodes {
+		if inliner.styleNodeSources[node] == nil {
+			styleNodes = append(styleNodes, node)
+		}
+	}
+
+	positions := styleElementRulePositions(inliner.source)
+	if len(positions) != len(styleNodes) {
+		return
+	}
+
+	for i, node := range styleNodes {
+		inliner.setStyleNodePositions(node, positions[i])
+	}
+}
+
+// collectElementsAndRules collects the elements matched by the rules of the stylesheets,
+// stopping when the context is canceled.
+func (inliner *Inliner) collectElementsAndRules() error {
+	// the hooks and the presentational attributes also apply to the elements only
+	// styled by their attributes
+	if inliner.elementHook != nil || inliner.declarationHook != nil || inliner.emitAttributes {
+		inliner.find("[style]").Each(func(i int, s *goquery.Selection) {
+			if inlinerDirective(s) != inlinerIgnore {
+				inliner.element(s)
+			}
+		})
+	}
+
+	for _, sheet := range inliner.stylesheets {
+		for i, rule := range sheet.stylesheet.Rules {
+			if err := inliner.ctx.Err(); err != nil {
+				return err
+			}
+
 			if rule.Kind == cssparser.QualifiedRule {
-				inliner.handleQualifiedRule(rule)
+				inliner.handleQualifiedRule(sheet, rule, sheet.ruleSource(i))
 			} else {
-				inliner.rawRules = append(inliner.rawRules, rule)
+				sheet.addRawRule(rule)
 			}
 		}
 	}
+
+	return nil
 }
 
-func (inliner *Inliner) handleQualifiedRule(rule *cssparser.CssRule) {
+func (inliner *Inliner) handleQualifiedRule(sheet *styleSheet, rule *cssparser.CssRule, source *CssSource) {
 	for _, selector := range rule.Selectors {
 		if Inlinable(selector) {
-			inliner.doc.Find(selector).Each(func(i int, s *goquery.Selection) {
-				// get marker
-				eltMarker, exists := s.Attr(elementMarkerAttr)
-				if !exists {
-					// mark element
-					eltMarker = strconv.Itoa(inliner.elementMarker)
-					s.SetAttr(elementMarkerAttr, eltMarker)
-					inliner.elementMarker++
-
-					// add new element
-					inliner.elements[eltMarker] = NewElement(s, inliner.parserOptions...)
+			ignored := false
+			inliner.find(selector).Each(func(i int, s *goquery.Selection) {
+				if inlinerDirective(s) == inlinerIgnore {
+					ignored = true
+					return
 				}
 
 				// add style rule for element
-				inliner.elements[eltMarker].addStyleRule(NewStyleRule(selector, rule.Declarations))
+				inliner.element(s).addStyleRule(newSourcedStyleRule(selector, rule.Declarations, source))
 			})
+
+			// opted out elements still get the rule from the output stylesheet
+			if ignored {
+				sheet.addRawRule(newSourcedStyleRule(selector, rule.Declarations, source))
+			}
+		} else if materialized := inliner.newPseudoElementRule(sheet, selector, rule.Declarations, source); materialized != nil && !inliner.matchesIgnored(materialized.base) {
+			// Materialize it into real elements
+			inliner.pseudoElementRules = append(inliner.pseudoElementRules, materialized)
+
+			// pseudo-elements without content in the rule still get it from the output stylesheet
+			if !materialized.content {
+				sheet.addRawRule(newSourcedStyleRule(selector, rule.Declarations, source))
+			}
+		} else if inliner.pseudoClassStyles && !inliner.keepStylePositions && !sheet.keep && hasDynamicPseudoClass(selector) {
+			// Keep it in the dedicated stylesheet
+			inliner.pseudoClassRules = append(inliner.pseudoClassRules, newSourcedStyleRule(selector, rule.Declarations, source))
 		} else {
 			// Keep it 'as is'
-			inliner.rawRules = append(inliner.rawRules, NewStyleRule(selector, rule.Declarations))
+			sheet.addRawRule(newSourcedStyleRule(selector, rule.Declarations, source))
 		}
 	}
 }
 
+// matchesIgnored returns whether the selector matches elements opted out of inlining.
+func (inliner *Inliner) matchesIgnored(selector string) bool {
+	return inliner.find(selector).FilterFunction(func(i int, s *goquery.Selection) bool {
+		return inlinerDirective(s) == inlinerIgnore
+	}).Length() > 0
+}
+
+// find returns the elements of the document matching a selector of the stylesheets,
+// including the root element of a subtree inlined with InlineNode.
+func (inliner *Inliner) find(selector string) *goquery.Selection {
+	selector = matchableSelector(selector)
+
+	// the synthetic root of a fragment is not part of the output
+	if inliner.doc.Nodes[0].Type == html.ElementNode && inliner.fragmentContext == "" {
+		return inliner.doc.Filter(selector).AddSelection(inliner.doc.Find(selector))
+	}
+
+	return inliner.doc.Find(selector)
+}
+
+// element returns the element to inline styles into, marking it on first use.
+func (inliner *Inliner) element(s *goquery.Selection) *Element {
+	// get marker
+	eltMarker, exists := s.Attr(elementMarkerAttr)
+	if !exists {
+		// mark element
+		eltMarker = strconv.Itoa(inliner.elementMarker)
+		s.SetAttr(elementMarkerAttr, eltMarker)
+		inliner.elementMarker++
+
+		// add new element
+		inliner.elements[eltMarker] = inliner.newElement(s)
+	}
+
+	return inliner.elements[eltMarker]
+}
+
+func (inliner *Inliner) newElement(s *goquery.Selection) *Element {
+	element := NewElement(s, inliner.parserOptions...)
+	element.attributeMappings = inliner.attributeMappings
+	element.minify = inliner.minify
+	element.hook = inliner.elementHook
+	element.declarationHook = inliner.declarationHook
+
+	if inliner.emitAttributes {
+		element.presentationalAttributes = inliner.presentationalAttributes
+	}
+
+	return element
+}
+
 func (inliner *Inliner) inlineStyleRules() error {
 	for _, element := range inliner.elements {
+		if err := inliner.ctx.Err(); err != nil {
+			return err
+		}
+
 		// remove marker
 		element.element.RemoveAttr(elementMarkerAttr)
 
@@ -282,45 +737,189 @@ func (inliner *Inliner) inlineStyleRules() error {
 	return nil
 }
 
-func (inliner *Inliner) computeRawCSS() string {
-	result := ""
+// computeRawCSS returns the content of a <style> element holding the given rules.
+func (inliner *Inliner) computeRawCSS(rawRules []fmt.Stringer) string {
+	if len(rawRules) == 0 {
+		return ""
+	}
 
-	for _, rawRule := range inliner.rawRules {
-		result += rawRule.String()
+	result := ""
+	if !inliner.minify {
 		result += "\n"
 	}
 
+	for _, rawRule := range rawRules {
+		result += inliner.ruleText(rawRule)
+	}
+
 	return result
 }
 
-func (inliner *Inliner) insertRawStylesheet() {
-	head := inliner.doc.Find("head")
+// ruleText returns the representation of a rule in the output stylesheets.
+func (inliner *Inliner) ruleText(rule fmt.Stringer) string {
+	if inliner.minify {
+		return minifyRule(rule)
+	}
+
+	return rule.String() + "\n"
+}
+
+func (inliner *Inliner) insertRawStylesheet() error {
+	if inliner.removeUnusedCSS {
+		for _, sheet := range inliner.stylesheets {
+			sheet.rawRules = inliner.purgeRules(sheet.rawRules)
+		}
+	}
+
+	if inliner.keepStylePositions {
+		return inliner.replaceStylesheets()
+	}
+
+	rawRules := []fmt.Stringer{}
+	for _, sheet := range inliner.stylesheets {
+		rawRules = append(rawRules, sheet.rawRules...)
+	}
+
+	rawCss := inliner.computeRawCSS(rawRules)
+	if rawCss != "" {
+		inliner.appendHeadStyleNode(newStyleNode(rawCss, []html.Attribute{{Key: "type", Val: "text/css"}}))
+	}
+
+	return nil
+}
+
+// prependHeadStyleNode inserts a <style> element at the start of the head of the
+// document, or of the fragment or detached subtree, after the ones previously inserted
+// there.
+func (inliner *Inliner) prependHeadStyleNode(styleNode *html.Node) {
+	parent := inliner.doc.Nodes[0]
+	if inliner.fragmentContext == "" {
+		if head := inliner.headNode(); head != nil {
+			parent = head
+		}
+	}
+
+	if inliner.lastHeadStyleNode == nil {
+		parent.InsertBefore(styleNode, parent.FirstChild)
+	} else {
+		parent.InsertBefore(styleNode, inliner.lastHeadStyleNode.NextSibling)
+	}
+
+	inliner.lastHeadStyleNode = styleNode
+}
+
+// appendHeadStyleNode appends a <style> element to the head of the document, or after
+// the <style> elements previously inserted at the start of a fragment or detached subtree.
+func (inliner *Inliner) appendHeadStyleNode(styleNode *html.Node) {
+	if inliner.fragmentContext != "" || inliner.headNode() == nil {
+		inliner.prependHeadStyleNode(styleNode)
+		return
+	}
+
+	inliner.headNode().AppendChild(styleNode)
+}
+
+// headNode returns the head element of the document, creating it if it doesn't exist.
+// For a subtree inlined with InlineNode, it returns the head element of the document
+// holding the subtree, or nil if the subtree is detached.
+func (inliner *Inliner) headNode() *html.Node {
+	if root := inliner.doc.Nodes[0]; root.Type != html.DocumentNode {
+		for root.Parent != nil {
+			root = root.Parent
+		}
+
+		if head := goquery.NewDocumentFromNode(root).Find("head").First(); head.Length() > 0 {
+			return head.Nodes[0]
+		}
+
+		return nil
+	}
 
 	// create a new head element if it doesn't exist
+	if inliner.doc.Find("head").Length() == 0 {
+		inliner.doc.Find("html").PrependHtml("<head></head>")
+	}
+
+	head := inliner.doc.Find("head").First() // ensure only one head element
+
 	if head.Length() == 0 {
-		head = inliner.doc.Find("html").PrependHtml("<head></head>").End()
-	} else if head.Length() > 1 {
-		head = head.First() // ensure only one head element
+		return inliner.doc.Nodes[0] // the document has no html element
 	}
 
-	rawCss := inliner.computeRawCSS()
-	if rawCss != "" {
-		cssNode := &html.Node{
-			Type: html.TextNode,
-			Data: "\n" + rawCss,
+	return head.Nodes[0]
+}
+
+// replaceStylesheets replaces the content of each parsed <style> element with its
+// non-inlinable rules, and removes the elements that have none left. The rules using
+// dynamic pseudo-classes stay in place too.
+func (inliner *Inliner) replaceStylesheets() error {
+	for _, sheet := range inliner.stylesheets {
+		if sheet.keep {
+			continue
+		}
+
+		rawRules, err := inliner.importantPseudoClassRules(sheet.rawRules)
+		if err != nil {
+			return err
+		}
+
+		rawCss := inliner.computeRawCSS(rawRules)
+
+		// programmatically supplied stylesheets get their own <style> element
+		if sheet.element == nil {
+			if rawCss == "" {
+				continue
+			}
+
+			styleNode := newStyleNode(rawCss, []html.Attribute{{Key: "type", Val: "text/css"}})
+			if sheet.position == BeforeDocumentStyles {
+				inliner.prependHeadStyleNode(styleNode)
+			} else {
+				inliner.appendHeadStyleNode(styleNode)
+			}
+			continue
+		}
+
+		if rawCss == "" {
+			sheet.element.Remove()
+			continue
 		}
 
-		styleNode := &html.Node{
-			Type: html.ElementNode,
-			Data: "style",
-			Attr: []html.Attribute{{Key: "type", Val: "text/css"}},
+		setStyleText(sheet.element, rawCss)
+	}
+
+	return nil
+}
+
+func (inliner *Inliner) removeInlinerAttributes() {
+	inliner.find("[" + inlinerAttr + "]").RemoveAttr(inlinerAttr)
+}
+
+func (inliner *Inliner) genHTML(w io.Writer) error {
+	if inliner.placeholders != nil {
+		var result strings.Builder
+		if err := inliner.renderHTML(&result); err != nil {
+			return err
 		}
 
-		styleNode.AppendChild(cssNode)
-		head.AppendNodes(styleNode)
+		_, err := io.WriteString(w, inliner.placeholders.restore(result.String()))
+		return err
 	}
+
+	return inliner.renderHTML(w)
 }
 
-func (inliner *Inliner) genHTML() (string, error) {
-	return inliner.doc.Html()
+func (inliner *Inliner) renderHTML(w io.Writer) error {
+	if inliner.outputOptions != nil {
+		return newRenderer(w, inliner.outputOptions, inliner.html).renderChildrenOf(inliner.doc.Nodes[0])
+	}
+
+	// the document node, or the synthetic context element of a fragment, is not rendered
+	for c := inliner.doc.Nodes[0].FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(w, c); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -1,14 +1,21 @@
 package cssinliner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/PuerkitoBio/goquery"
 	"go.baoshuo.dev/cssparser"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 func TestInline(t *testing.T) {
@@ -141,6 +148,24 @@ func TestInlineWithComplexSelectors(t *testing.T) {
 	}
 }
 
+func TestInlineWithMatchesAnyPseudoClasses(t *testing.T) {
+	source := `<html><head><style>:is(h1, h2) { color: red; } :where(#main) p { color: blue; } p { color: green; } a:link { color: orange; }</style></head><body><div id="main"><h1>Title</h1><p>Text</p><a href="#">Link</a></div></body></html>`
+	expected := `<html><head><style type="text/css">
+a:link {
+  color: orange;
+}
+</style></head><body><div id="main"><h1 style="color: red;">Title</h1><p style="color: green;">Text</p><a href="#">Link</a></div></body></html>`
+
+	result, err := Inline(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
 func TestInlineWithBrokenCSS(t *testing.T) {
 	source := `<html><head><style>
 	.name {
@@ -166,3 +191,794 @@ func TestInlineWithBrokenCSS(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+func TestInlineWithKeepStylePositions(t *testing.T) {
+	source := `<html><head><title>Test</title><style media="screen" nonce="abc">p { color: red; } a:hover { color: blue; }</style><meta charset="utf-8"/><style>p { margin: 0; }</style></head><body><p>Hello</p><a href="#">Link</a></body></html>`
+	expected := `<html><head><title>Test</title><style media="screen" nonce="abc">
+a:hover {
+  color: blue;
+}
+</style><meta charset="utf-8"/></head><body><p style="color: red; margin: 0;">Hello</p><a href="#">Link</a></body></html>`
+
+	result, err := Inline(source, WithKeepStylePositions(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithOptOutMarkers(t *testing.T) {
+	source := `<html><head><style data-inliner="ignore">u + .body p { color: green; }</style><style data-inliner="keep">p { color: red; }</style><style>.skip { color: blue; }</style></head><body><p>Hello</p><p class="skip" data-inliner="ignore">Skipped</p></body></html>`
+	expected := `<html><head><style>u + .body p { color: green; }</style><style>p { color: red; }</style><style type="text/css">
+.skip {
+  color: blue;
+}
+</style></head><body><p style="color: red;">Hello</p><p class="skip">Skipped</p></body></html>`
+
+	result, err := Inline(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPseudoClassStyles(t *testing.T) {
+	source := `<html><head><style>a { color: red; } a:hover { color: blue; text-decoration: underline; }</style></head><body><a href="#">Link</a></body></html>`
+	expected := `<html><head><style type="text/css">
+a:hover {
+  color: blue !important;
+  text-decoration: underline;
+}
+</style></head><body><a href="#" style="color: red;">Link</a></body></html>`
+
+	result, err := Inline(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPseudoClassStylesInPlace(t *testing.T) {
+	source := `<html><head><style id="main">a { color: red; } a:hover { color: blue; } @media (max-width: 600px) { a { font-size: 12px; } }</style></head><body><a href="#">Link</a></body></html>`
+	expected := `<html><head><style id="main">
+a:hover {
+  color: blue !important;
+}
+@media (max-width: 600px) {
+  a {
+    font-size: 12px;
+  }
+}
+</style></head><body><a href="#" style="color: red;">Link</a></body></html>`
+
+	result, err := Inline(source, WithKeepStylePositions(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	expected = `<html><head><style id="main">
+a:hover {
+  color: blue;
+}
+@media (max-width: 600px) {
+  a {
+    font-size: 12px;
+  }
+}
+</style></head><body><a href="#" style="color: red;">Link</a></body></html>`
+
+	result, err = Inline(source, WithKeepStylePositions(true), WithPseudoClassStyles(false, ""))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithRootRules(t *testing.T) {
+	source := `<html><head><style>:root { --brand: #ff6600; color: #333; } html { color: #000; } p { color: var(--brand); }</style></head><body><p>Hello</p></body></html>`
+	expected := `<html style="--brand: #ff6600; color: #333;"><head></head><body><p style="color: var(--brand);">Hello</p></body></html>`
+
+	result, err := Inline(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithMaterializePseudoElements(t *testing.T) {
+	source := `<html><head><style>
+		a.next::after { content: " \2192"; color: red; }
+		abbr:before { content: attr(title) ": "; }
+		ol { counter-reset: item; }
+		li::before { content: counter(item) ". "; counter-increment: item; font-weight: bold; }
+		p::before { content: url(icon.png); }
+	</style></head><body><a class="next" href="#">Next</a><abbr title="Note">Text</abbr><ol><li>One</li><li>Two</li></ol><p>Hello</p></body></html>`
+	expected := `<html><head><style type="text/css">
+p::before {
+  content: url(icon.png);
+}
+</style></head><body><a class="next" href="#">Next<span style="color: red;"> →</span></a><abbr title="Note"><span>Note: </span>Text</abbr><ol style="counter-reset: item;"><li><span style="font-weight: bold;">1. </span>One</li><li><span style="font-weight: bold;">2. </span>Two</li></ol><p>Hello</p></body></html>`
+
+	result, err := Inline(source, WithMaterializePseudoElements(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPartiallyMaterializedPseudoElements(t *testing.T) {
+	source := `<html><head><style>
+		.icon::before { color: red; }
+		.star::before { content: "*"; }
+	</style></head><body><i class="icon">Icon</i><i class="icon star">Star</i><i class="star" data-inliner="ignore">Ignored</i></body></html>`
+	expected := `<html><head><style type="text/css">
+.icon::before {
+  color: red;
+}
+.star::before {
+  content: "*";
+}
+</style></head><body><i class="icon">Icon</i><i class="icon star">Star</i><i class="star">Ignored</i></body></html>`
+
+	result, err := Inline(source, WithMaterializePseudoElements(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+	// rules without content style the pseudo-elements of other rules, and are kept
+	source = `<html><head><style>
+		.icon::before { color: red; }
+		.star::before { content: "*"; }
+	</style></head><body><i class="icon">Icon</i><i class="icon star">Star</i></body></html>`
+	expected = `<html><head><style type="text/css">
+.icon::before {
+  color: red;
+}
+</style></head><body><i class="icon">Icon</i><i class="icon star"><span style="color: red;">*</span>Star</i></body></html>`
+
+	result, err = Inline(source, WithMaterializePseudoElements(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithMaterializedPseudoElementCounters(t *testing.T) {
+	source := `<html><head><style>
+		ol { counter-reset: item; }
+		li { counter-increment: item; }
+		li::before { content: counter(item) ". "; }
+		h2::before { content: counter(section) " "; counter-increment: section; }
+	</style></head><body><h2>A</h2><ol><li>One</li><li>Two<ol><li>Nested</li></ol></li><li>Three</li></ol><h2>B</h2><ol><li>Four</li><li>Five</li></ol></body></html>`
+	expected := `<html><head></head><body><h2><span>1 </span>A</h2><ol style="counter-reset: item;"><li style="counter-increment: item;"><span>1. </span>One</li><li style="counter-increment: item;"><span>2. </span>Two<ol style="counter-reset: item;"><li style="counter-increment: item;"><span>1. </span>Nested</li></ol></li><li style="counter-increment: item;"><span>3. </span>Three</li></ol><h2><span>2 </span>B</h2><ol style="counter-reset: item;"><li style="counter-increment: item;"><span>1. </span>Four</li><li style="counter-increment: item;"><span>2. </span>Five</li></ol></body></html>`
+
+	result, err := Inline(source, WithMaterializePseudoElements(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithRemoveUnusedCSS(t *testing.T) {
+	source := `<html><head><style>p { color: red; } a:hover { color: blue; } .missing:hover { color: green; } ul li:focus { color: black; }</style></head><body><p>Hello</p><a href="#">Link</a></body></html>`
+	expected := `<html><head><style type="text/css">
+a:hover {
+  color: blue;
+}
+</style></head><body><p style="color: red;">Hello</p><a href="#">Link</a></body></html>`
+
+	report := &Report{}
+
+	result, err := Inline(source, WithRemoveUnusedCSS(true), WithReport(report))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	if report.RemovedRules != 2 || report.RemovedBytes != 67 {
+		t.Errorf("Expected 2 removed rules and 67 removed bytes, got %d and %d", report.RemovedRules, report.RemovedBytes)
+	}
+}
+
+func TestInlineWithRemoveUnusedClassesAndIDs(t *testing.T) {
+	source := `<html><head><style>.title { color: red; } .link:hover { color: blue; } #main .hover\:underline:hover { text-decoration: underline; }</style></head><body><div id="main"><h1 class="title big" id="top">Hello</h1><a class="link js-toggle hover:underline" href="#top">Link</a></div></body></html>`
+	expected := `<html><head><style type="text/css">
+.link:hover {
+  color: blue;
+}
+#main .hover\:underline:hover {
+  text-decoration: underline;
+}
+</style></head><body><div id="main"><h1 style="color: red;" id="top">Hello</h1><a class="link js-toggle hover:underline" href="#top">Link</a></div></body></html>`
+
+	result, err := Inline(source, WithRemoveUnusedClassesAndIDs(true, "js-toggle", "top"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineReader(t *testing.T) {
+	source := `<html><head><style>body { color: red; }</style></head><body>Hello Reader</body></html>`
+	expected := `<html><head></head><body style="color: red;">Hello Reader</body></html>`
+
+	var result strings.Builder
+
+	err := InlineReader(context.Background(), strings.NewReader(source), &result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = InlineReader(ctx, strings.NewReader(source), &result)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled error, got %v", err)
+	}
+
+	// the inlining stops at the next element once the context is canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	hook := func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		calls++
+		cancel()
+		return declarations, nil
+	}
+
+	source = `<html><head><style>p { color: red; }</style></head><body><p>A</p><p>B</p><p>C</p></body></html>`
+
+	err = InlineReader(ctx, strings.NewReader(source), &result, WithElementHook(hook))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context canceled error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the hook to be called once, got %d calls", calls)
+	}
+}
+
+func TestInlineDocument(t *testing.T) {
+	source := `<html><head><style>p { color: red; } p:hover { color: blue; }</style></head><body><p>Hello Document</p></body></html>`
+	expected := `<html><head><style type="text/css">
+p:hover {
+  color: blue !important;
+}
+</style></head><body><p style="color: red;">Hello Document</p></body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := InlineDocument(doc); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result, err := doc.Html()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineNode(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello Node</p></body></html>`
+	expected := `<html><head></head><body><p style="color: red;">Hello Node</p></body></html>`
+
+	node, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := InlineNode(node); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := html.Render(&result, node); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+}
+
+func TestInlineNodeSubtree(t *testing.T) {
+	source := `<html><head></head><body><div class="card"><style>.card { color: red; } .card p { margin: 0; } .card::before { content: "*"; } a:hover { color: blue; }</style><p>Hello Subtree</p></div><p>Outside</p></body></html>`
+	expected := `<html><head><style type="text/css">
+a:hover {
+  color: blue;
+}
+</style></head><body><div class="card" style="color: red;"><span>*</span><p style="margin: 0;">Hello Subtree</p></div><p>Outside</p></body></html>`
+
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// the root of the subtree is matched, and the non-inlinable rules go to the head of its document
+	node := goquery.NewDocumentFromNode(doc).Find(".card").Nodes[0]
+	if err := InlineNode(node, WithMaterializePseudoElements(true)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := html.Render(&result, doc); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+
+	// the non-inlinable rules are inserted at the start of a detached subtree
+	nodes, err := html.ParseFragment(strings.NewReader(`<div class="card"><style>.card { color: red; } .card:hover { color: blue; }</style><p>Detached</p></div>`), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := InlineNode(nodes[0], WithMinify(true)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result.Reset()
+	if err := html.Render(&result, nodes[0]); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected = `<div class="card" style="color:red"><style type="text/css">.card:hover{color:blue!important}</style><p>Detached</p></div>`
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+}
+
+func TestInlineFragment(t *testing.T) {
+	source := `<p class="intro">Hello Fragment</p><a href="#">Link</a>`
+	css := `.intro { color: red; } a:hover { color: blue; }`
+	expected := `<style type="text/css">
+a:hover {
+  color: blue;
+}
+</style><p class="intro" style="color: red;">Hello Fragment</p><a href="#">Link</a>`
+
+	result, err := InlineFragment(source, css)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithFragmentContext(t *testing.T) {
+	source := `<style>td { padding: 0; }</style><td>Cell</td>`
+	expected := `<td style="padding: 0;">Cell</td>`
+
+	result, err := Inline(source, WithFragmentContext("tr"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPlaceholders(t *testing.T) {
+	source := `<html><head><style>p { color: {{ .Color }}; } a { margin: 0; }</style></head><body><p>*|FNAME|*</p><a href="{{ .URL "home" }}" style="{{ .LinkStyle }}">Link</a></body></html>`
+	expected := `<html><head></head><body><p style="color: {{ .Color }};">*|FNAME|*</p><a href="{{ .URL "home" }}" style="margin: 0; {{ .LinkStyle }}">Link</a></body></html>`
+
+	result, err := Inline(source, WithPlaceholders(GoTemplateDelimiters, MailchimpDelimiters))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPlaceholdersAndRemoveUnusedClassesAndIDs(t *testing.T) {
+	source := `<html><head><style>.btn { color: red; } .used:hover { color: blue; }</style></head><body><a class="btn {{ .Extra }} used unused" id="{{ .ID }}">A</a><a class="btn-{{ .Variant }}" id="unused">B</a></body></html>`
+	expected := `<html><head><style type="text/css">
+.used:hover {
+  color: blue !important;
+}
+</style></head><body><a class="{{ .Extra }} used" id="{{ .ID }}" style="color: red;">A</a><a class="btn-{{ .Variant }}">B</a></body></html>`
+
+	result, err := Inline(source, WithPlaceholders(GoTemplateDelimiters), WithRemoveUnusedClassesAndIDs(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineFileWithImports(t *testing.T) {
+	source := `<html><head><style>@import "base.css"; /* @import "commented.css"; */</style><link rel="stylesheet" href="./style.css" /></head><body><p>Hello Imports</p></body></html>`
+	expected := `<html><head><style type="text/css">
+@import "base.css";
+@import url("partials/text.css");
+@import 'missing.css' screen;
+</style></head><body><p style="color: red;">Hello Imports</p></body></html>`
+
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		"index.html":        source,
+		"base.css":          `body { margin: 0; }`,
+		"style.css":         `@import url("partials/text.css"); @import 'missing.css' screen; p { color: red; }`,
+		"partials/text.css": `@import "../style.css"; p { color: blue; }`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	report := &Report{}
+
+	result, err := InlineFile(filepath.Join(tempDir, "index.html"), WithReport(report), WithParserOptions(cssparser.WithLooseParsing(true)))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// the @import rules are kept as is
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	expectedFiles := []string{"base.css", "style.css", "partials/text.css", "missing.css"}
+	if len(report.LocalFiles) != len(expectedFiles) {
+		t.Fatalf("Expected %d local files, got %v", len(expectedFiles), report.LocalFiles)
+	}
+	for i, name := range expectedFiles {
+		if report.LocalFiles[i] != filepath.Join(tempDir, name) {
+			t.Errorf("Expected %s, got %s", filepath.Join(tempDir, name), report.LocalFiles[i])
+		}
+	}
+}
+
+func TestInlineWithStylesheets(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello Stylesheets</p></body></html>`
+
+	tests := []struct {
+		position StylesheetPosition
+		expected string
+	}{
+		{BeforeDocumentStyles, `<html><head></head><body><p style="color: red; margin: 0;">Hello Stylesheets</p></body></html>`},
+		{AfterDocumentStyles, `<html><head></head><body><p style="color: blue; margin: 0;">Hello Stylesheets</p></body></html>`},
+	}
+
+	for _, test := range tests {
+		result, err := Inline(source, WithStylesheetsAt(test.position, `p { color: blue; }`, `p { margin: 0; }`))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		if result != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, result)
+		}
+	}
+
+	// stylesheets are applied before the document styles by default
+	result, err := Inline(source, WithStylesheets(`p { color: blue; }`, `p { margin: 0; }`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != tests[0].expected {
+		t.Errorf("Expected %s, got %s", tests[0].expected, result)
+	}
+}
+
+func TestInlineWithCompiledStylesheet(t *testing.T) {
+	source := `<html><head><style id="doc">a:hover { color: red; }</style></head><body><p>Hello Compiled</p></body></html>`
+	expected := `<html><head><style type="text/css">
+p:hover {
+  color: green !important;
+}
+</style><style id="doc">
+a:hover {
+  color: red;
+}
+</style><style type="text/css">
+a:hover {
+  color: blue;
+}
+</style></head><body><p style="color: green;">Hello Compiled</p></body></html>`
+
+	before, err := cssparser.ParseStylesheet(`p { color: green; } p:hover { color: green; }`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	result, err := Inline(source,
+		WithCompiledStylesheet(BeforeDocumentStyles, before),
+		WithStylesheetsAt(AfterDocumentStyles, `a:hover { color: blue; }`),
+		WithKeepStylePositions(true),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithCssPreprocessor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/css")
+		w.Write([]byte("a { color: $remote; }"))
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	htmlPath := filepath.Join(tempDir, "index.html")
+	if err := os.WriteFile(filepath.Join(tempDir, "style.css"), []byte("p { color: $local; }"), 0644); err != nil {
+		t.Fatalf("Failed to write stylesheet: %v", err)
+	}
+
+	source := fmt.Sprintf(`<html><head><style>body { color: $style; }</style><link rel="stylesheet" href="style.css" /><link rel="stylesheet" href="%s" /></head><body><p>Local</p><a>Remote</a><span>Injected</span><em style="color: $attribute;">Attribute</em></body></html>`, server.URL)
+	expected := `<html><head></head><body style="color: style;"><p style="background-color: local;">Local</p><a style="background-color: remote;">Remote</a><span style="color: injected;">Injected</span><em style="color: attribute;">Attribute</em></body></html>`
+
+	kinds := map[CssSourceKind]bool{}
+	preprocessor := func(css string, source *CssSource) (string, error) {
+		kinds[source.Kind] = true
+
+		if source.Kind == LocalFileSource && source.Path != filepath.Join(tempDir, "style.css") {
+			t.Errorf("Expected the path of the local stylesheet, got %s", source.Path)
+		}
+
+		return strings.ReplaceAll(css, "$"+source.Kind.String(), source.Kind.String()), nil
+	}
+
+	result, err := NewInliner(source,
+		WithAllowReadLocalFiles(true, htmlPath),
+		WithAllowLoadRemoteStylesheets(true),
+		WithStylesheetsAt(AfterDocumentStyles, "span { color: $injected; }"),
+		WithCssPreprocessor(preprocessor, true),
+		// the file preprocessor only applies to the local and remote files, before the CSS preprocessor
+		WithCssFilePreprocessor(func(css, path string) (string, error) {
+			return strings.ReplaceAll(css, "color:", "background-color:"), nil
+		}),
+	).Inline()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	if len(kinds) != 5 {
+		t.Errorf("Expected the 5 kinds of sources to be preprocessed, got %v", kinds)
+	}
+}
+
+func TestInlineWithCssPreprocessorOnKeptStylesheet(t *testing.T) {
+	source := `<html><head><style data-inliner="keep">p { color: $brand; }</style></head><body><p>Hello</p></body></html>`
+	expected := `<html><head><style>p { color: red; }</style></head><body><p style="color: red;">Hello</p></body></html>`
+
+	preprocessor := func(css string, source *CssSource) (string, error) {
+		return strings.ReplaceAll(css, "$brand", "red"), nil
+	}
+
+	result, err := Inline(source, WithCssPreprocessor(preprocessor, false))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithElementHook(t *testing.T) {
+	source := `<html><head><style>p { line-height: 20px; } td { display: flex; color: red; }</style></head><body><p>Hello Hook</p><table><tr><td>Cell</td><td style="display: flex;">Inline</td></tr></table></body></html>`
+	expected := `<html><head></head><body><p style="line-height: 20px; mso-line-height-rule: exactly;">Hello Hook</p><table><tbody><tr><td style="color: red;">Cell</td><td style="color: red;">Inline</td></tr></tbody></table></body></html>`
+
+	inline := map[string]bool{}
+	hook := func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		result := []*StyleDeclaration{}
+
+		for _, styleDecl := range declarations {
+			if styleDecl.Declaration.Property == "display" && goquery.NodeName(element) == "td" {
+				inline[element.Text()] = styleDecl.Inline()
+				continue
+			}
+
+			result = append(result, styleDecl)
+
+			if styleDecl.Declaration.Property == "line-height" {
+				result = append(result, &StyleDeclaration{
+					Declaration: &cssparser.Declaration{Property: "mso-line-height-rule", Value: "exactly"},
+				})
+			}
+		}
+
+		return result, nil
+	}
+
+	result, err := Inline(source, WithElementHook(hook))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	if inline["Cell"] || !inline["Inline"] {
+		t.Errorf("Expected the provenance of the declarations, got %v", inline)
+	}
+
+	// the elements whose declarations are unchanged by the hook are left as is
+	source = `<html><head><style>p { color: red; }</style></head><body><p>Hello Hook</p><em style="COLOR:blue;margin:0">Unchanged</em></body></html>`
+	expected = `<html><head></head><body><p style="color: red;">Hello Hook</p><em style="COLOR:blue;margin:0">Unchanged</em></body></html>`
+
+	result, err = Inline(source, WithElementHook(func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		return declarations, nil
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithInvalidElementHook(t *testing.T) {
+	source := `<html><head><style>p { color: red; }</style></head><body><p>Hello Hook</p></body></html>`
+
+	_, err := Inline(source, WithElementHook(func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		return append(declarations, &StyleDeclaration{}), nil
+	}))
+	if err == nil {
+		t.Errorf("Expected an error for a declaration without its CSS declaration")
+	}
+
+	styleDecl := &StyleDeclaration{Declaration: &cssparser.Declaration{Property: "color", Value: "red"}}
+	if specificity := styleDecl.Specificity(); specificity != 0 {
+		t.Errorf("Expected specificity 0 without style rule, got %d", specificity)
+	}
+}
+
+func TestInlineWithElementHookOrigins(t *testing.T) {
+	source := `<html><head><style>td { padding: 0; }</style></head><body><table><tr><td bgcolor="#ffffff" style="color: red;">Cell</td></tr></table></body></html>`
+
+	origins := map[string]string{}
+	_, err := Inline(source, WithElementHook(func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		for _, styleDecl := range declarations {
+			switch {
+			case styleDecl.Inline():
+				origins[styleDecl.Declaration.Property] = "style"
+			case styleDecl.Attribute():
+				origins[styleDecl.Declaration.Property] = "attribute"
+			default:
+				origins[styleDecl.Declaration.Property] = "stylesheet"
+			}
+		}
+
+		return declarations, nil
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]string{"background-color": "attribute", "color": "style", "padding": "stylesheet"}
+	for property, origin := range expected {
+		if origins[property] != origin {
+			t.Errorf("Expected %s to come from the %s, got %s", property, origin, origins[property])
+		}
+	}
+}
+
+func TestInlineWithDeclarationHook(t *testing.T) {
+	source := `<html><head><style>p { font-size: 1rem; color: red; margin: 0; }</style></head><body><p>Hello Hook</p><em style="font-size: 2rem;">Inline</em><b>Unstyled</b></body></html>`
+	expected := `<html><head></head><body><p style="color: red; font-size: 16px; mso-line-height-rule: exactly;">Hello Hook</p><em style="font-size: 32px; mso-line-height-rule: exactly;">Inline</em><b>Unstyled</b></body></html>`
+
+	declarationHook := func(element *goquery.Selection, styleDecl *StyleDeclaration) (*StyleDeclaration, error) {
+		switch styleDecl.Declaration.Property {
+		case "margin":
+			return nil, nil
+		case "font-size":
+			rem, err := strconv.ParseFloat(strings.TrimSuffix(styleDecl.Declaration.Value, "rem"), 64)
+			if err != nil {
+				return nil, err
+			}
+
+			return &StyleDeclaration{
+				StyleRule:   styleDecl.StyleRule,
+				Declaration: &cssparser.Declaration{Property: "font-size", Value: strconv.FormatFloat(rem*16, 'f', -1, 64) + "px"},
+			}, nil
+		}
+
+		return styleDecl, nil
+	}
+
+	// the element hook receives the declarations returned by the declaration hook
+	elementHook := func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error) {
+		for _, styleDecl := range declarations {
+			if styleDecl.Declaration.Property == "font-size" && strings.HasSuffix(styleDecl.Declaration.Value, "px") {
+				return append(declarations, &StyleDeclaration{
+					Declaration: &cssparser.Declaration{Property: "mso-line-height-rule", Value: "exactly"},
+				}), nil
+			}
+		}
+
+		return declarations, nil
+	}
+
+	result, err := Inline(source, WithDeclarationHook(declarationHook), WithElementHook(elementHook))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	_, err = Inline(source, WithDeclarationHook(func(element *goquery.Selection, styleDecl *StyleDeclaration) (*StyleDeclaration, error) {
+		return &StyleDeclaration{StyleRule: styleDecl.StyleRule}, nil
+	}))
+	if err == nil {
+		t.Errorf("Expected an error for a declaration without its CSS declaration")
+	}
+}
@@ -0,0 +1,164 @@
+package cssinliner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	cssparser "go.baoshuo.dev/cssparser"
+)
+
+var (
+	whitespaceRegexp   = regexp.MustCompile(`\s+`)
+	separatorRegexp    = regexp.MustCompile(`\s*([,>+~])\s*`)
+	valueSepRegexp     = regexp.MustCompile(`\s*,\s*`)
+	zeroUnitRegexp     = regexp.MustCompile(`(^|[\s,(/])-?0+(?:\.0+)?(?:px|em|rem|ex|ch|pt|pc|in|cm|mm|q|vw|vh|vmin|vmax)\b`)
+	mathFunctionRegexp = regexp.MustCompile(`(?i)(?:^|[^\w-])(?:calc|min|max|clamp)\(`)
+	hexColorRegexp     = regexp.MustCompile(`#([0-9a-fA-F]{6})\b`)
+	unminifiedSegment  = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|(?i:url)\([^)]*\)`)
+)
+
+// minifySegments applies the given function to the parts of a CSS text that are
+// not strings nor `url()` values.
+func minifySegments(css string, minify func(segment string) string) string {
+	result := ""
+	last := 0
+
+	for _, loc := range unminifiedSegment.FindAllStringIndex(css, -1) {
+		result += minify(css[last:loc[0]]) + css[loc[0]:loc[1]]
+		last = loc[1]
+	}
+
+	return strings.TrimSpace(result + minify(css[last:]))
+}
+
+// minifyValue minifies a declaration value: whitespaces are collapsed, units are
+// removed from zero lengths and hexadecimal colors are shortened.
+//
+// Units are kept in `flex` values, where a unitless zero is not a length, and in
+// custom properties, whose values may be used in math functions.
+func minifyValue(property, value string) string {
+	keepUnits := isFlexProperty(property) || strings.HasPrefix(property, "--")
+
+	return minifySegments(value, func(segment string) string {
+		segment = whitespaceRegexp.ReplaceAllString(segment, " ")
+		segment = valueSepRegexp.ReplaceAllString(segment, ",")
+
+		if !keepUnits {
+			segment = removeZeroUnits(segment)
+		}
+
+		return hexColorRegexp.ReplaceAllStringFunc(segment, func(match string) string {
+			hex := strings.ToLower(match[1:])
+			if hex[0] == hex[1] && hex[2] == hex[3] && hex[4] == hex[5] {
+				return "#" + hex[0:1] + hex[2:3] + hex[4:5]
+			}
+
+			return "#" + hex
+		})
+	})
+}
+
+// removeZeroUnits removes the units from zero lengths, except in math functions
+// (e.g. `calc(0px + 10px)`) where they're required.
+func removeZeroUnits(segment string) string {
+	result := ""
+
+	for {
+		loc := mathFunctionRegexp.FindStringIndex(segment)
+		if loc == nil {
+			return result + zeroUnitRegexp.ReplaceAllString(segment, "${1}0")
+		}
+
+		end := min(skipSelectorBlock(segment, loc[1]-1, '(', ')')+1, len(segment))
+		result += zeroUnitRegexp.ReplaceAllString(segment[:loc[1]], "${1}0") + segment[loc[1]:end]
+		segment = segment[end:]
+	}
+}
+
+// isFlexProperty returns whether the property is `flex` or `flex-basis`, with or
+// without vendor prefix.
+func isFlexProperty(property string) bool {
+	property = strings.ToLower(property)
+
+	return strings.HasSuffix(property, "flex") || strings.HasSuffix(property, "flex-basis")
+}
+
+// minifySelector collapses the whitespaces of a selector, and removes the ones
+// around combinators and commas.
+func minifySelector(selector string) string {
+	return minifySegments(selector, func(segment string) string {
+		segment = whitespaceRegexp.ReplaceAllString(segment, " ")
+
+		return separatorRegexp.ReplaceAllString(segment, "$1")
+	})
+}
+
+// minifyDeclarations returns the minified declarations, separated by semicolons
+// and without trailing semicolon.
+func minifyDeclarations(declarations []*cssparser.Declaration, important bool) string {
+	result := []string{}
+
+	for _, declaration := range declarations {
+		value := declaration.Property + ":" + minifyValue(declaration.Property, declaration.Value)
+		if important && declaration.Important {
+			value += "!important"
+		}
+
+		result = append(result, value)
+	}
+
+	return strings.Join(result, ";")
+}
+
+// minifyRule returns the minified representation of a style rule or of a CSS rule.
+func minifyRule(rule fmt.Stringer) string {
+	switch rule := rule.(type) {
+	case *StyleRule:
+		return minifySelector(rule.Selector) + "{" + minifyDeclarations(rule.Declarations, true) + "}"
+	case *cssparser.CssRule:
+		return minifyCssRule(rule)
+	}
+
+	return rule.String()
+}
+
+func minifyCssRule(rule *cssparser.CssRule) string {
+	result := ""
+
+	if rule.Kind == cssparser.QualifiedRule {
+		result += minifySelector(strings.Join(rule.Selectors, ","))
+	} else {
+		result += rule.Name
+
+		if prelude := minifyPrelude(rule.Prelude); prelude != "" {
+			result += " " + prelude
+		}
+	}
+
+	if len(rule.Declarations) == 0 && len(rule.Rules) == 0 {
+		return result + ";"
+	}
+
+	result += "{"
+
+	if rule.EmbedsRules() {
+		for _, subRule := range rule.Rules {
+			result += minifyCssRule(subRule)
+		}
+	} else {
+		result += minifyDeclarations(rule.Declarations, true)
+	}
+
+	return result + "}"
+}
+
+// minifyPrelude minifies an at-rule prelude (e.g. `screen and (max-width: 600px)`).
+func minifyPrelude(prelude string) string {
+	return minifySegments(prelude, func(segment string) string {
+		segment = whitespaceRegexp.ReplaceAllString(segment, " ")
+		segment = strings.ReplaceAll(segment, ": ", ":")
+
+		return valueSepRegexp.ReplaceAllString(segment, ",")
+	})
+}
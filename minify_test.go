@@ -0,0 +1,69 @@
+package cssinliner
+
+import "testing"
+
+func TestMinifyValue(t *testing.T) {
+	cases := map[string]string{
+		"0px  auto":                    "0 auto",
+		"10px 0.0em -0px 20px":         "10px 0 0 20px",
+		"#FFFFFF":                      "#fff",
+		"1px solid #AaBbCd":            "1px solid #aabbcd",
+		`"Helvetica Neue" , Arial`:     `"Helvetica Neue",Arial`,
+		`url(  "a  0px.png" )`:         `url(  "a  0px.png" )`,
+		"rgba(0, 0, 0, 0.5)":           "rgba(0,0,0,0.5)",
+		"12px/1.5 Arial,   sans-serif": "12px/1.5 Arial,sans-serif",
+		"calc(0px + 10px) 0px":         "calc(0px + 10px) 0",
+		"max(0em, min(0px, 1vw)) 0px":  "max(0em,min(0px,1vw)) 0",
+		"CLAMP(0px, 1vw, 0px)":         "CLAMP(0px,1vw,0px)",
+		"translate(0px)":               "translate(0)",
+	}
+
+	for value, expected := range cases {
+		if result := minifyValue("margin", value); result != expected {
+			t.Errorf("minifyValue(%q): expected %q, got %q", value, expected, result)
+		}
+	}
+}
+
+func TestMinifyValueWithUnits(t *testing.T) {
+	cases := map[string]string{
+		"flex":         "1 1 0px",
+		"-webkit-flex": "1 1 0px",
+		"flex-basis":   "0px",
+		"--gap":        "0px",
+	}
+
+	for property, value := range cases {
+		if result := minifyValue(property, value); result != value {
+			t.Errorf("minifyValue(%q, %q): expected %q, got %q", property, value, value, result)
+		}
+	}
+}
+
+func TestMinifySelector(t *testing.T) {
+	cases := map[string]string{
+		"div  >  p":             "div>p",
+		"h1 , h2 + p ~ span":    "h1,h2+p~span",
+		`a[title="a > b"] span`: `a[title="a > b"] span`,
+	}
+
+	for selector, expected := range cases {
+		if result := minifySelector(selector); result != expected {
+			t.Errorf("minifySelector(%q): expected %q, got %q", selector, expected, result)
+		}
+	}
+}
+
+func TestInlineWithMinify(t *testing.T) {
+	source := `<html><head><style>p { margin: 0px auto; color: #FF0000; } a:hover { color: #0000ff !important; }</style></head><body><p style="padding: 0em;">Hello</p><a href="#">Link</a></body></html>`
+	expected := `<html><head><style type="text/css">a:hover{color:#00f!important}</style></head><body><p style="color:#f00;margin:0 auto;padding:0">Hello</p><a href="#">Link</a></body></html>`
+
+	result, err := Inline(source, WithMinify(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
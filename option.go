@@ -1,6 +1,9 @@
 package cssinliner
 
 import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
 	"go.baoshuo.dev/cssparser"
 )
 
@@ -41,14 +44,244 @@ func WithHtmlPreprocessor(preprocessor HtmlPreprocessor) InlinerOption {
 
 type CssFilePreprocessor func(css, path string) (string, error)
 
-// WithCssPreprocessor allows setting a custom CSS preprocessor function.
+// WithCssFilePreprocessor allows setting a custom CSS preprocessor function.
 // This function can be used to modify the CSS before inlining.
 //
 // NOTE: This function only applies to CSS files, not <style> tags.
-// If you want to preprocess CSS in <style> tags, use the `WithHtmlPreprocessor` option
-// to modify the HTML to include the preprocessed CSS directly in the <style> tags.
+// If you want to preprocess every CSS source, including <style> tags, use the
+// `WithCssPreprocessor` option instead.
 func WithCssFilePreprocessor(preprocessor CssFilePreprocessor) InlinerOption {
 	return func(inliner *Inliner) {
 		inliner.cssFilePreprocessor = preprocessor
 	}
 }
+
+// WithAttributeMappings allows adding, replacing or disabling the mappings used to
+// convert presentational HTML attributes into CSS declarations.
+//
+// A mapping replaces the existing mappings with the same attribute and property,
+// and a mapping with an empty property disables every mapping of its attribute.
+func WithAttributeMappings(mappings ...*AttributeMapping) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.attributeMappings = mergeAttributeMappings(inliner.attributeMappings, mappings...)
+	}
+}
+
+// WithPresentationalAttributes allows the inliner to write presentational HTML attributes
+// (e.g. `width`, `bgcolor`, `align`, `valign`, `cellpadding`) from the inlined CSS declarations, for
+// email clients that ignore the corresponding CSS properties.
+func WithPresentationalAttributes(enable bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.emitAttributes = enable
+	}
+}
+
+// WithPresentationalAttributeMappings allows adding, replacing or disabling the mappings
+// used by `WithPresentationalAttributes`.
+//
+// A mapping replaces the existing mappings with the same property and attribute,
+// and a mapping with an empty attribute disables every mapping of its property.
+func WithPresentationalAttributeMappings(attributes ...*PresentationalAttribute) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.presentationalAttributes = mergePresentationalAttributes(inliner.presentationalAttributes, attributes...)
+	}
+}
+
+// WithKeepStylePositions allows keeping the non-inlinable CSS rules in the <style> elements
+// they were read from (including the ones replacing loaded <link> elements), with their
+// attributes preserved, instead of moving them all into a single <style> element
+// appended to the <head>.
+func WithKeepStylePositions(keep bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.keepStylePositions = keep
+	}
+}
+
+// WithPseudoClassStyles controls how the rules using dynamic pseudo-classes (e.g.
+// `:hover`, `:focus`) are kept. By default, they're inserted into a dedicated <style>
+// element, appended to the first element matching the target selector (the <head>
+// element if empty or not found). With `WithKeepStylePositions`, they stay in their
+// original <style> elements instead.
+//
+// The `!important` flag is added to the declarations of properties inlined on the
+// matching elements, so that interactive states keep working. If disabled, they're
+// kept as is with the other non-inlinable rules.
+func WithPseudoClassStyles(enable bool, target string) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.pseudoClassStyles = enable
+		inliner.pseudoClassTarget = target
+	}
+}
+
+// WithMaterializePseudoElements allows the inliner to materialize ::before and ::after
+// pseudo-elements into real <span> elements carrying their inlined styles, for email
+// clients that strip <style> elements.
+//
+// Only `content` values made of strings, `attr()` and `counter()` functions are
+// supported, and rules using other values are kept in the output stylesheet, as are
+// the rules matching elements opted out with `data-inliner="ignore"`. Rules without
+// `content` style the materialized elements and are also kept.
+func WithMaterializePseudoElements(enable bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.materializePseudoElements = enable
+	}
+}
+
+// WithRemoveUnusedCSS allows the inliner to remove the non-inlinable rules whose
+// selectors (with pseudo-classes and pseudo-elements stripped) match no element,
+// along with the @media and @supports blocks left empty.
+func WithRemoveUnusedCSS(remove bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.removeUnusedCSS = remove
+	}
+}
+
+// WithReport allows collecting information about the inlining, such as the number
+// of bytes saved by removing unused CSS, into the given report.
+func WithReport(report *Report) InlinerOption {
+	return func(inliner *Inliner) {
+		if report != nil {
+			inliner.report = report
+		}
+	}
+}
+
+// WithRemoveUnusedClassesAndIDs allows the inliner to remove the `class` and `id`
+// attribute values that are not referenced by the <style> elements of the output
+// document. The names in the allowlist (e.g. JavaScript hooks or anchors) are kept.
+//
+// NOTE: <link> elements that are not loaded by the inliner are not taken into account.
+func WithRemoveUnusedClassesAndIDs(remove bool, allowlist ...string) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.removeUnusedClassesAndIDs = remove
+		inliner.keptClassesAndIDs = append(inliner.keptClassesAndIDs, allowlist...)
+	}
+}
+
+// WithMinify allows the inliner to minify the output stylesheets and style attributes:
+// whitespaces are collapsed, units are removed from zero lengths, hexadecimal colors
+// are shortened and trailing semicolons are removed.
+func WithMinify(minify bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.minify = minify
+	}
+}
+
+// WithOutputOptions allows controlling how the output HTML document is serialized,
+// e.g. with the XHTML self-closing syntax, the original doctype or named entities.
+//
+// NOTE: InlineDocument and InlineNode don't serialize the document, and reject the
+// options preserving parts of the source document.
+func WithOutputOptions(options OutputOptions) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.outputOptions = &options
+	}
+}
+
+// WithFragmentContext parses the HTML content as a fragment in a context element with
+// the given tag name (e.g. `body`, `td`), instead of a full document. The output only
+// contains the fragment markup, with the non-inlinable rules in a <style> element at
+// its start. An empty tag name disables the fragment mode.
+func WithFragmentContext(tag string) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.fragmentContext = strings.ToLower(tag)
+	}
+}
+
+// WithPlaceholders protects the template placeholders enclosed in the given delimiters
+// (e.g. GoTemplateDelimiters, LiquidTagDelimiters, MailchimpDelimiters) from HTML
+// escaping and CSS parsing, and restores them as is in the output.
+//
+// NOTE: Placeholders are only supported in text, attribute names and values, and
+// declaration values. The whole document is read in memory to mask them.
+func WithPlaceholders(delimiters ...Delimiters) InlinerOption {
+	return func(inliner *Inliner) {
+		if len(delimiters) == 0 {
+			inliner.placeholders = nil
+			return
+		}
+
+		inliner.placeholders = &placeholders{delimiters: delimiters}
+	}
+}
+
+// WithStylesheets allows supplying stylesheets in addition to the <style> and <link>
+// elements of the document, applied before them in the cascade so that the document
+// styles win.
+func WithStylesheets(css ...string) InlinerOption {
+	return WithStylesheetsAt(BeforeDocumentStyles, css...)
+}
+
+// WithStylesheetsAt allows supplying stylesheets in addition to the <style> and <link>
+// elements of the document, applied before or after them in the cascade.
+func WithStylesheetsAt(position StylesheetPosition, css ...string) InlinerOption {
+	return func(inliner *Inliner) {
+		for _, stylesheet := range css {
+			inliner.extraStylesheets = append(inliner.extraStylesheets, &extraStylesheet{position: position, css: stylesheet})
+		}
+	}
+}
+
+// WithCompiledStylesheet allows supplying an already parsed stylesheet in addition to
+// the <style> and <link> elements of the document, applied before or after them in
+// the cascade. The stylesheet is not modified, so it can be shared between inliners.
+func WithCompiledStylesheet(position StylesheetPosition, stylesheet *cssparser.Stylesheet) InlinerOption {
+	return func(inliner *Inliner) {
+		if stylesheet != nil {
+			inliner.extraStylesheets = append(inliner.extraStylesheets, &extraStylesheet{position: position, stylesheet: stylesheet})
+		}
+	}
+}
+
+type CssPreprocessor func(css string, source *CssSource) (string, error)
+
+// WithCssPreprocessor allows setting a custom CSS preprocessor function, applied to
+// every CSS source: <style> tags, local and remote CSS files, and stylesheets supplied
+// with `WithStylesheets`. The source describes where the CSS comes from.
+//
+// If styleAttributes is true, it's also applied to the `style` attribute of each element.
+//
+// NOTE: For CSS files, it's applied after the `WithCssFilePreprocessor` function.
+// Stylesheets supplied with `WithCompiledStylesheet` are already parsed, so they're
+// not preprocessed.
+func WithCssPreprocessor(preprocessor CssPreprocessor, styleAttributes bool) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.cssPreprocessor = preprocessor
+		inliner.preprocessStyleAttrs = styleAttributes
+	}
+}
+
+// ElementHook is called with each element receiving styles and its winning declarations,
+// sorted by property name, and returns the declarations to write in its `style` attribute.
+type ElementHook func(element *goquery.Selection, declarations []*StyleDeclaration) ([]*StyleDeclaration, error)
+
+// WithElementHook allows modifying the winning declarations of each element before they're
+// written in its `style` attribute and presentational attributes, e.g. to add a declaration
+// whenever another one is set, or to drop declarations unsupported on some elements.
+//
+// The style rule of each declaration tells where it comes from: StyleDeclaration.Inline
+// and StyleDeclaration.Attribute tell the `style` attribute and the presentational
+// attributes of the element from the stylesheet rules. New declarations can be
+// returned with a nil style rule, but not with a nil declaration. The `style` attribute
+// of an element matching no rule is only rewritten if the hook changes its declarations.
+func WithElementHook(hook ElementHook) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.elementHook = hook
+	}
+}
+
+// DeclarationHook is called with an element and one of its winning declarations, and
+// returns the declaration to write instead, or nil to drop it.
+type DeclarationHook func(element *goquery.Selection, declaration *StyleDeclaration) (*StyleDeclaration, error)
+
+// WithDeclarationHook allows modifying each winning declaration of each element on its
+// own, e.g. to convert `rem` values into pixels, without handling the whole list.
+//
+// NOTE: The declaration hook runs before the element hook, which receives the declarations
+// it returned. As with WithElementHook, the `style` attribute of an element matching no
+// rule is only rewritten if the hook changes its declarations.
+func WithDeclarationHook(hook DeclarationHook) InlinerOption {
+	return func(inliner *Inliner) {
+		inliner.declarationHook = hook
+	}
+}
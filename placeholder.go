@@ -0,0 +1,161 @@
+package cssinliner
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Delimiters are the opening and closing delimiters of template placeholders.
+type Delimiters struct {
+	Open  string // Opening delimiter (e.g. `{{`)
+	Close string // Closing delimiter (e.g. `}}`)
+}
+
+var (
+	GoTemplateDelimiters = Delimiters{Open: "{{", Close: "}}"} // Go template actions, also used by Liquid and Handlebars outputs
+	LiquidTagDelimiters  = Delimiters{Open: "{%", Close: "%}"} // Liquid tags
+	MailchimpDelimiters  = Delimiters{Open: "*|", Close: "|*"} // Mailchimp merge tags
+)
+
+const placeholderTokenPrefix = "__cssinliner_ph_"
+
+// Tokens replacing placeholders. They are lower-cased valid CSS identifiers, so that
+// they go through HTML and CSS parsing unchanged. Tokens used as attribute names are
+// serialized with an empty value (e.g. `<a {{ .Attrs }}>`), which is removed.
+//
+// Tokens in text are wrapped in comments, as the HTML parser moves the text found
+// in tables out of them (e.g. `<table>{{ range .Rows }}<tr>...</tr>{{ end }}</table>`).
+var placeholderTokenRegexp = regexp.MustCompile(`<!--` + placeholderTokenPrefix + `(\d+)__-->|` + placeholderTokenPrefix + `(\d+)__(?:=""|='')?`)
+
+var textPlaceholderTokenRegexp = regexp.MustCompile(placeholderTokenPrefix + `\d+__`)
+
+// Placeholders standing for whole declarations in a style attribute (e.g. `style="{{ .Styles }}"`).
+var stylePlaceholderRegexp = regexp.MustCompile(`(?:^|;)\s*(` + placeholderTokenPrefix + `\d+__)\s*(?:;|$)`)
+
+// placeholders masks the template placeholders of an HTML content with tokens, and
+// restores them after serialization.
+type placeholders struct {
+	delimiters []Delimiters
+	values     []string // Masked placeholders, by token index
+}
+
+// mask replaces the placeholders found in the HTML content with tokens.
+func (p *placeholders) mask(content string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(content); {
+		delimiters, ok := p.delimitersAt(content, i)
+		if !ok {
+			result.WriteByte(content[i])
+			i++
+			continue
+		}
+
+		end := strings.Index(content[i+len(delimiters.Open):], delimiters.Close)
+		if end < 0 {
+			result.WriteString(content[i:])
+			break
+		}
+		end += i + len(delimiters.Open) + len(delimiters.Close)
+
+		result.WriteString(placeholderTokenPrefix + strconv.Itoa(len(p.values)) + "__")
+		p.values = append(p.values, content[i:end])
+		i = end
+	}
+
+	return commentTextPlaceholders(result.String())
+}
+
+// commentTextPlaceholders wraps the tokens found in text in comments. Tokens in tags,
+// comments and raw text elements (e.g. <style>) are kept as is.
+func commentTextPlaceholders(content string) string {
+	var result strings.Builder
+
+	z := html.NewTokenizer(strings.NewReader(content))
+	rawText := false
+
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			if !errors.Is(z.Err(), io.EOF) {
+				return content
+			}
+
+			return result.String()
+		}
+
+		raw := string(z.Raw())
+		if tokenType == html.TextToken && !rawText {
+			raw = textPlaceholderTokenRegexp.ReplaceAllString(raw, "<!--${0}-->")
+		}
+		result.WriteString(raw)
+
+		// comments are not parsed in the content of raw text and RCDATA elements
+		rawText = false
+		if tokenType == html.StartTagToken {
+			name, _ := z.TagName()
+			rawText = rawTextElements[string(name)] || string(name) == "textarea" || string(name) == "title"
+		}
+	}
+}
+
+func (p *placeholders) delimitersAt(content string, i int) (Delimiters, bool) {
+	for _, delimiters := range p.delimiters {
+		if delimiters.Open != "" && delimiters.Close != "" && strings.HasPrefix(content[i:], delimiters.Open) {
+			return delimiters, true
+		}
+	}
+
+	return Delimiters{}, false
+}
+
+// restore replaces the tokens found in the output with the original placeholders.
+func (p *placeholders) restore(content string) string {
+	return placeholderTokenRegexp.ReplaceAllStringFunc(content, func(token string) string {
+		matches := placeholderTokenRegexp.FindStringSubmatch(token)
+		index, err := strconv.Atoi(matches[1] + matches[2])
+		if err != nil || index >= len(p.values) {
+			return token
+		}
+
+		return p.values[index]
+	})
+}
+
+// extractStylePlaceholders removes the placeholders standing for whole declarations
+// from a style attribute value, as they can't be parsed as CSS.
+func extractStylePlaceholders(styleValue string) (string, []string) {
+	result := []string{}
+
+	for {
+		loc := stylePlaceholderRegexp.FindStringSubmatchIndex(styleValue)
+		if loc == nil {
+			return styleValue, result
+		}
+
+		result = append(result, styleValue[loc[2]:loc[3]])
+		styleValue = styleValue[:loc[2]] + styleValue[loc[3]:]
+	}
+}
+
+// appendStylePlaceholders appends placeholders standing for whole declarations to
+// a style attribute value.
+func appendStylePlaceholders(styleValue string, tokens []string, minify bool) string {
+	for _, token := range tokens {
+		if styleValue != "" && !strings.HasSuffix(styleValue, ";") {
+			styleValue += ";"
+		}
+		if styleValue != "" && !minify {
+			styleValue += " "
+		}
+
+		styleValue += token
+	}
+
+	return styleValue
+}
@@ -0,0 +1,70 @@
+package cssinliner
+
+import (
+	"testing"
+)
+
+func TestPlaceholdersMaskAndRestore(t *testing.T) {
+	p := &placeholders{delimiters: []Delimiters{GoTemplateDelimiters, LiquidTagDelimiters, MailchimpDelimiters}}
+
+	source := `<a href="{{ .URL "x" }}">{% if user %}*|FNAME|*{% endif %}</a> {{ unclosed`
+	masked := p.mask(source)
+
+	expectedMasked := `<a href="__cssinliner_ph_0__"><!--__cssinliner_ph_1__--><!--__cssinliner_ph_2__--><!--__cssinliner_ph_3__--></a> {{ unclosed`
+	if masked != expectedMasked {
+		t.Errorf("Expected %s, got %s", expectedMasked, masked)
+	}
+
+	if result := p.restore(masked); result != source {
+		t.Errorf("Expected %s, got %s", source, result)
+	}
+
+	if result := p.restore(`<a __cssinliner_ph_1__="">`); result != `<a {% if user %}>` {
+		t.Errorf("Expected %s, got %s", `<a {% if user %}>`, result)
+	}
+}
+
+func TestPlaceholdersMaskInRawText(t *testing.T) {
+	p := &placeholders{delimiters: []Delimiters{GoTemplateDelimiters}}
+
+	source := `<title>{{ .Title }}</title><style>p { color: {{ .Color }}; }</style><!-- {{ .Note }} --><p>{{ .Text }}</p>`
+	expected := `<title>__cssinliner_ph_0__</title><style>p { color: __cssinliner_ph_1__; }</style><!-- __cssinliner_ph_2__ --><p><!--__cssinliner_ph_3__--></p>`
+
+	if masked := p.mask(source); masked != expected {
+		t.Errorf("Expected %s, got %s", expected, masked)
+	}
+}
+
+func TestInlineWithPlaceholdersInTable(t *testing.T) {
+	source := `<html><head><style>td { padding: 4px; }</style></head><body><table>{{ range .Rows }}<tr><td>{{ .Name }}</td></tr>{{ end }}</table></body></html>`
+	expected := `<html><head></head><body><table>{{ range .Rows }}<tbody><tr><td style="padding: 4px;">{{ .Name }}</td></tr>{{ end }}</tbody></table></body></html>`
+
+	result, err := Inline(source, WithPlaceholders(GoTemplateDelimiters))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestExtractStylePlaceholders(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+		tokens   int
+	}{
+		{"__cssinliner_ph_0__", "", 1},
+		{"color: red; __cssinliner_ph_0__", "color: red; ", 1},
+		{"__cssinliner_ph_0__; color: red;", "; color: red;", 1},
+		{"color: __cssinliner_ph_0__;", "color: __cssinliner_ph_0__;", 0},
+	}
+
+	for _, test := range tests {
+		result, tokens := extractStylePlaceholders(test.source)
+		if result != test.expected || len(tokens) != test.tokens {
+			t.Errorf("Expected %q with %d tokens for %q, got %q with %d tokens", test.expected, test.tokens, test.source, result, len(tokens))
+		}
+	}
+}
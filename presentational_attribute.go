@@ -0,0 +1,215 @@
+package cssinliner
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	cssparser "go.baoshuo.dev/cssparser"
+)
+
+var (
+	dimensionValueRegexp = regexp.MustCompile(`^(\d+(?:\.\d+)?)(px|%)?$`)
+	colorValueRegexp     = regexp.MustCompile(`^(#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6}|[a-zA-Z]+)$`)
+)
+
+// PresentationalAttribute describes how a computed CSS declaration is written back
+// as a presentational HTML attribute (e.g. `background-color: #fff` into `bgcolor="#fff"`).
+//
+// This is the inverse of AttributeMapping, and it's required by clients that ignore
+// some CSS properties, like the Word rendering engine of Outlook.
+type PresentationalAttribute struct {
+	Property  string                            // The name of the CSS property
+	Attribute string                            // The name of the HTML attribute, empty disables the property
+	Elements  []string                          // The elements that receive this attribute, empty means every element
+	Transform func(value string) (string, bool) // Optional transform, returning false skips the attribute
+	Table     bool                              // Whether the attribute is written on the enclosing <table> when all its cells agree
+}
+
+var defaultPresentationalAttributes = []*PresentationalAttribute{
+	{
+		Property:  "width",
+		Attribute: "width",
+		Elements:  []string{"img", "table", "th", "td"},
+		Transform: DimensionAttributeValue,
+	},
+	{
+		Property:  "height",
+		Attribute: "height",
+		Elements:  []string{"img", "table", "th", "td"},
+		Transform: DimensionAttributeValue,
+	},
+	{
+		Property:  "background-color",
+		Attribute: "bgcolor",
+		Elements:  []string{"body", "table", "tr", "th", "td"},
+		Transform: ColorAttributeValue,
+	},
+	{
+		Property:  "float",
+		Attribute: "align",
+		Elements:  []string{"img", "table"},
+		Transform: keywordAttributeValue("left", "right"),
+	},
+	{
+		Property:  "text-align",
+		Attribute: "align",
+		Elements:  []string{"h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "tr", "th", "td"},
+		Transform: keywordAttributeValue("left", "center", "right", "justify"),
+	},
+	{
+		Property:  "vertical-align",
+		Attribute: "valign",
+		Elements:  []string{"tr", "th", "td"},
+		Transform: keywordAttributeValue("top", "middle", "bottom", "baseline"),
+	},
+	{
+		Property:  "padding",
+		Attribute: "cellpadding",
+		Elements:  []string{"th", "td"},
+		Transform: DimensionAttributeValue,
+		Table:     true,
+	},
+}
+
+// DimensionAttributeValue converts pixel and percentage values into HTML dimension
+// attribute values (`600px` into `600`, `100%` is kept as is).
+func DimensionAttributeValue(value string) (string, bool) {
+	matches := dimensionValueRegexp.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return "", false
+	}
+
+	if matches[2] == "%" {
+		return matches[1] + "%", true
+	}
+
+	return matches[1], true
+}
+
+// ColorAttributeValue accepts hexadecimal and named colors, which are the only
+// color values understood by legacy HTML attributes.
+func ColorAttributeValue(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if !colorValueRegexp.MatchString(value) {
+		return "", false
+	}
+
+	switch strings.ToLower(value) {
+	case "transparent", "inherit", "initial", "unset", "currentcolor":
+		return "", false
+	}
+
+	return value, true
+}
+
+func keywordAttributeValue(keywords ...string) func(value string) (string, bool) {
+	return func(value string) (string, bool) {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		return value, slices.Contains(keywords, value)
+	}
+}
+
+func (attribute *PresentationalAttribute) appliesTo(elementName string) bool {
+	return len(attribute.Elements) == 0 || slices.Contains(attribute.Elements, elementName)
+}
+
+func (attribute *PresentationalAttribute) value(declaration *cssparser.Declaration) (string, bool) {
+	if attribute.Transform != nil {
+		return attribute.Transform(declaration.Value)
+	}
+
+	return declaration.Value, true
+}
+
+// setTableAttributes writes the presentational attributes of the tables whose cells
+// all have the same value for the property (e.g. `cellpadding` from the `padding`
+// of every cell).
+func (inliner *Inliner) setTableAttributes() {
+	attributes := []*PresentationalAttribute{}
+	for _, attribute := range inliner.presentationalAttributes {
+		if attribute.Table {
+			attributes = append(attributes, attribute)
+		}
+	}
+
+	if len(attributes) == 0 {
+		return
+	}
+
+	inliner.find("table").Each(func(i int, table *goquery.Selection) {
+		// cells of nested tables belong to them
+		cells := table.Find("th, td").FilterFunction(func(i int, cell *goquery.Selection) bool {
+			return cell.Closest("table").IsSelection(table)
+		})
+
+		for _, attribute := range attributes {
+			if value, ok := inliner.tableAttributeValue(attribute, cells); ok {
+				table.SetAttr(attribute.Attribute, value)
+			}
+		}
+	})
+}
+
+// tableAttributeValue returns the attribute value shared by all the given cells.
+func (inliner *Inliner) tableAttributeValue(attribute *PresentationalAttribute, cells *goquery.Selection) (string, bool) {
+	result := ""
+	ok := cells.Length() > 0
+
+	cells.EachWithBreak(func(i int, cell *goquery.Selection) bool {
+		value, found := "", false
+		if attribute.appliesTo(cell.Nodes[0].Data) {
+			value, found = inliner.inlinedAttributeValue(attribute, cell)
+		}
+
+		ok = found && (i == 0 || value == result)
+		result = value
+
+		return ok
+	})
+
+	return result, ok
+}
+
+// inlinedAttributeValue returns the attribute value of the property declared in the
+// style attribute of an element.
+func (inliner *Inliner) inlinedAttributeValue(attribute *PresentationalAttribute, s *goquery.Selection) (string, bool) {
+	styleValue, exists := s.Attr("style")
+	if !exists {
+		return "", false
+	}
+
+	styleValue, _ = extractStylePlaceholders(styleValue)
+	declarations, err := cssparser.ParseDeclarations(styleValue, inliner.parserOptions...)
+	if err != nil {
+		return "", false
+	}
+
+	value, found := "", false
+	for _, declaration := range declarations {
+		if declaration.Property == attribute.Property {
+			value, found = attribute.value(declaration)
+		}
+	}
+
+	return value, found
+}
+
+// mergePresentationalAttributes adds the given attributes to the list. An attribute
+// replaces existing ones with the same property and attribute name, and an attribute
+// without name removes every attribute of its property.
+func mergePresentationalAttributes(attributes []*PresentationalAttribute, updates ...*PresentationalAttribute) []*PresentationalAttribute {
+	for _, update := range updates {
+		attributes = slices.DeleteFunc(slices.Clone(attributes), func(attribute *PresentationalAttribute) bool {
+			return attribute.Property == update.Property && (update.Attribute == "" || attribute.Attribute == update.Attribute)
+		})
+
+		if update.Attribute != "" {
+			attributes = append(attributes, update)
+		}
+	}
+
+	return attributes
+}
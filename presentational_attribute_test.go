@@ -0,0 +1,80 @@
+package cssinliner
+
+import "testing"
+
+func TestDimensionAttributeValue(t *testing.T) {
+	cases := map[string]string{
+		"600px": "600",
+		"100%":  "100%",
+		"320":   "320",
+	}
+
+	for value, expected := range cases {
+		if result, ok := DimensionAttributeValue(value); !ok || result != expected {
+			t.Errorf("DimensionAttributeValue(%q): expected %q, got %q", value, expected, result)
+		}
+	}
+
+	for _, value := range []string{"auto", "10em", "calc(100% - 10px)"} {
+		if result, ok := DimensionAttributeValue(value); ok {
+			t.Errorf("DimensionAttributeValue(%q): expected no value, got %q", value, result)
+		}
+	}
+}
+
+func TestInlineWithPresentationalAttributes(t *testing.T) {
+	source := `<html><head><style>
+		table { width: 600px; background-color: #ffffff; }
+		td { text-align: center; vertical-align: top; width: auto; }
+	</style></head><body><table><tr><td>Cell</td></tr></table></body></html>`
+	expected := `<html><head></head><body><table style="background-color: #ffffff; width: 600px;" width="600" bgcolor="#ffffff"><tbody><tr><td style="text-align: center; vertical-align: top; width: auto;" align="center" valign="top">Cell</td></tr></tbody></table></body></html>`
+
+	result, err := Inline(source, WithPresentationalAttributes(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithCellpaddingAttribute(t *testing.T) {
+	source := `<html><head><style>
+		.padded td { padding: 8px; }
+		.mixed td { padding: 8px; }
+		.mixed td.wide { padding: 16px; }
+	</style></head><body>
+		<table class="padded"><tr><td>A</td><td>B</td></tr></table>
+		<table class="mixed"><tr><td>A</td><td class="wide">B</td></tr></table>
+		<table><tr><td style="padding: 4px">A</td></tr></table>
+	</body></html>`
+	expected := `<html><head></head><body>
+		<table class="padded" cellpadding="8"><tbody><tr><td style="padding: 8px;">A</td><td style="padding: 8px;">B</td></tr></tbody></table>
+		<table class="mixed"><tbody><tr><td style="padding: 8px;">A</td><td class="wide" style="padding: 16px;">B</td></tr></tbody></table>
+		<table cellpadding="4"><tbody><tr><td style="padding: 4px">A</td></tr></tbody></table>
+	</body></html>`
+
+	result, err := Inline(source, WithPresentationalAttributes(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestInlineWithPresentationalAttributesFromStyleAttribute(t *testing.T) {
+	source := `<html><head></head><body><table style="width: 600px"><tr><td style="text-align: right">Cell</td></tr></table></body></html>`
+	expected := `<html><head></head><body><table style="width: 600px" width="600"><tbody><tr><td style="text-align: right" align="right">Cell</td></tr></tbody></table></body></html>`
+
+	result, err := Inline(source, WithPresentationalAttributes(true))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
@@ -0,0 +1,166 @@
+package cssinliner
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/PuerkitoBio/goquery"
+	cssparser "go.baoshuo.dev/cssparser"
+	"golang.org/x/net/html"
+)
+
+// Pseudo-classes depending on user interaction, which can't be inlined but still
+// work in email clients supporting <style> elements.
+var dynamicPseudoClasses = []string{"hover", "active", "focus", "focus-visible", "focus-within", "visited", "target"}
+
+func hasDynamicPseudoClass(selector string) bool {
+	result := false
+
+	for _, pseudo := range parseSelectorPseudos(selector) {
+		if pseudo.element {
+			return false
+		}
+
+		result = result || slices.Contains(dynamicPseudoClasses, pseudo.name)
+	}
+
+	return result
+}
+
+// stripDynamicPseudoClasses returns the selector matching the elements that the
+// pseudo-classes of the given selector apply to.
+func stripDynamicPseudoClasses(selector string) string {
+	return stripSelectorPseudos(selector, func(pseudo selectorPseudo) bool {
+		return slices.Contains(dynamicPseudoClasses, pseudo.name)
+	})
+}
+
+// importantPseudoClassRule returns a copy of the given rule with `!important` added
+// to the declarations of properties that are inlined on the elements it applies to,
+// as inlined styles would otherwise win over the rule.
+func (inliner *Inliner) importantPseudoClassRule(rule *StyleRule) (*StyleRule, error) {
+	elements := inliner.find(stripDynamicPseudoClasses(rule.Selector))
+	declarations := []*cssparser.Declaration{}
+
+	for _, declaration := range rule.Declarations {
+		important := declaration.Important
+		var err error
+
+		elements.EachWithBreak(func(i int, s *goquery.Selection) bool {
+			var properties map[string]bool
+			if properties, err = inliner.inlinedProperties(s.Nodes[0]); err != nil {
+				return false
+			}
+
+			important = important || properties[declaration.Property]
+			return !important
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		declarations = append(declarations, &cssparser.Declaration{
+			Property:  declaration.Property,
+			Value:     declaration.Value,
+			Important: important,
+		})
+	}
+
+	result := NewStyleRule(rule.Selector, declarations)
+	result.Source = rule.Source
+
+	return result, nil
+}
+
+// importantPseudoClassRules returns the given rules, with `!important` added where
+// needed to the ones using dynamic pseudo-classes.
+func (inliner *Inliner) importantPseudoClassRules(rules []fmt.Stringer) ([]fmt.Stringer, error) {
+	result := []fmt.Stringer{}
+
+	for _, rule := range rules {
+		if styleRule, ok := rule.(*StyleRule); ok && inliner.pseudoClassStyles && hasDynamicPseudoClass(styleRule.Selector) {
+			var err error
+			if rule, err = inliner.importantPseudoClassRule(styleRule); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, rule)
+	}
+
+	return result, nil
+}
+
+// inlinedProperties returns the properties inlined in the style attribute of an element.
+func (inliner *Inliner) inlinedProperties(node *html.Node) (map[string]bool, error) {
+	if properties, ok := inliner.inlinedPropertiesCache[node]; ok {
+		return properties, nil
+	}
+
+	properties := make(map[string]bool)
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || attr.Key != "style" {
+			continue
+		}
+
+		styleValue, _ := extractStylePlaceholders(attr.Val)
+		declarations, err := cssparser.ParseDeclarations(styleValue, inliner.parserOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, declaration := range declarations {
+			properties[declaration.Property] = true
+		}
+	}
+
+	if inliner.inlinedPropertiesCache == nil {
+		inliner.inlinedPropertiesCache = make(map[*html.Node]map[string]bool)
+	}
+	inliner.inlinedPropertiesCache[node] = properties
+
+	return properties, nil
+}
+
+// insertPseudoClassStylesheet inserts the rules using dynamic pseudo-classes into a
+// dedicated <style> element.
+func (inliner *Inliner) insertPseudoClassStylesheet() error {
+	if len(inliner.pseudoClassRules) == 0 {
+		return nil
+	}
+
+	rules := []fmt.Stringer{}
+	for _, rule := range inliner.pseudoClassRules {
+		if inliner.removeUnusedCSS && inliner.purgeRule(rule) == nil {
+			inliner.report.RemovedBytes += len(inliner.ruleText(rule))
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	rules, err := inliner.importantPseudoClassRules(rules)
+	if err != nil {
+		return err
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	styleNode := newStyleNode(inliner.computeRawCSS(rules), []html.Attribute{{Key: "type", Val: "text/css"}})
+
+	if inliner.pseudoClassTarget == "" {
+		inliner.appendHeadStyleNode(styleNode)
+		return nil
+	}
+
+	if target := inliner.find(inliner.pseudoClassTarget).First(); target.Length() > 0 {
+		target.AppendNodes(styleNode)
+	} else {
+		inliner.appendHeadStyleNode(styleNode)
+	}
+
+	return nil
+}
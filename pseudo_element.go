@@ -0,0 +1,412 @@
+package cssinliner
+
+import (
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	cssparser "go.baoshuo.dev/cssparser"
+	"golang.org/x/net/html"
+)
+
+// Elements that can't have ::before and ::after pseudo-elements.
+var voidElements = []string{
+	"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// Properties only applying to the pseudo-element box generation, not copied to the
+// materialized element.
+var pseudoElementProperties = []string{"content", "counter-increment", "counter-reset"}
+
+// pseudoElementRule is a ::before or ::after rule materialized into real elements.
+type pseudoElementRule struct {
+	styleRule *StyleRule // The style rule, with the full selector
+	base      string     // The selector of the elements the pseudo-element belongs to
+	pseudo    string     // The pseudo-element name ("before" or "after")
+	content   bool       // Whether the rule has a `content` declaration, without which it only styles the pseudo-elements of other rules
+}
+
+// newPseudoElementRule returns the materializable rule for the given selector, or nil
+// if the selector doesn't end with a ::before or ::after pseudo-element, or if its
+// `content` can't be evaluated.
+//
+// Rules without `content` only style the pseudo-elements materialized from other rules,
+// so they must also be kept in the output stylesheet.
+func newPseudoElementRule(selector string, declarations []*cssparser.Declaration) *pseudoElementRule {
+	selector = strings.TrimSpace(selector)
+
+	pseudos := parseSelectorPseudos(selector)
+	if len(pseudos) == 0 {
+		return nil
+	}
+
+	last := pseudos[len(pseudos)-1]
+	if !last.element || (last.name != "before" && last.name != "after") || last.end != len(selector) {
+		return nil
+	}
+
+	base := strings.TrimSpace(selector[:last.start])
+	if base == "" || strings.ContainsRune(" >+~", rune(selector[last.start-1])) {
+		base += "*"
+	}
+
+	if !Inlinable(base) {
+		return nil
+	}
+
+	content := false
+	for _, declaration := range declarations {
+		if declaration.Property == "content" {
+			if _, ok := evalContentValue(declaration.Value, nil, nil); !ok {
+				return nil
+			}
+			content = true
+		}
+	}
+
+	return &pseudoElementRule{
+		styleRule: NewStyleRule(selector, declarations),
+		base:      base,
+		pseudo:    last.name,
+		content:   content,
+	}
+}
+
+// newPseudoElementRule returns the materializable rule for the given selector if
+// pseudo-elements materialization is enabled.
+func (inliner *Inliner) newPseudoElementRule(sheet *styleSheet, selector string, declarations []*cssparser.Declaration, source *CssSource) *pseudoElementRule {
+	if !inliner.materializePseudoElements || sheet.keep {
+		return nil
+	}
+
+	rule := newPseudoElementRule(selector, declarations)
+	if rule != nil {
+		rule.styleRule.Source = source
+	}
+
+	return rule
+}
+
+// insertPseudoElements inserts <span> elements holding the content and the styles
+// of the ::before and ::after pseudo-elements.
+func (inliner *Inliner) insertPseudoElements() {
+	if len(inliner.pseudoElementRules) == 0 {
+		return
+	}
+
+	// style rules of each pseudo-element, by element
+	rules := map[*html.Node]map[string][]*StyleRule{}
+
+	for _, rule := range inliner.pseudoElementRules {
+		inliner.find(rule.base).Each(func(i int, s *goquery.Selection) {
+			node := s.Nodes[0]
+			if slices.Contains(voidElements, node.Data) || inlinerDirective(s) == inlinerIgnore {
+				return
+			}
+
+			if rules[node] == nil {
+				rules[node] = map[string][]*StyleRule{}
+			}
+
+			rules[node][rule.pseudo] = append(rules[node][rule.pseudo], rule.styleRule)
+		})
+	}
+
+	root := inliner.doc.Nodes[0]
+	scope := &counterScope{counters: cssCounters{}}
+
+	// the root of a subtree inlined with InlineNode has its own pseudo-elements
+	if root.Type == html.ElementNode && inliner.fragmentContext == "" {
+		inliner.materializeElementPseudoElements(root, rules, scope)
+	} else {
+		inliner.materializeChildPseudoElements(root, rules, scope)
+	}
+}
+
+// materializeChildPseudoElements inserts the pseudo-elements of the descendants of an
+// element, in document order, so that counters are computed as rendered.
+func (inliner *Inliner) materializeChildPseudoElements(parent *html.Node, rules map[*html.Node]map[string][]*StyleRule, scope *counterScope) {
+	children := []*html.Node{}
+	for child := parent.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			children = append(children, child)
+		}
+	}
+
+	for _, child := range children {
+		inliner.materializeElementPseudoElements(child, rules, scope)
+	}
+}
+
+// materializeElementPseudoElements inserts the pseudo-elements of an element and of its
+// descendants, with the counters in scope of its parent.
+func (inliner *Inliner) materializeElementPseudoElements(node *html.Node, rules map[*html.Node]map[string][]*StyleRule, scope *counterScope) {
+	// counters of the element are in scope for its following siblings
+	scope.apply(styleAttributeDeclarations(node, inliner.parserOptions))
+
+	// pseudo-elements are the first and last children of the element
+	s := inliner.doc.FindNodes(node)
+	if node == inliner.doc.Nodes[0] {
+		s = inliner.doc.Selection
+	}
+	childScope := scope.child()
+
+	before := materializePseudoElement(s, rules[node]["before"], childScope, inliner.minify)
+	inliner.materializeChildPseudoElements(node, rules, childScope)
+	after := materializePseudoElement(s, rules[node]["after"], childScope, inliner.minify)
+
+	childScope.close()
+
+	if before != nil {
+		s.PrependNodes(before)
+	}
+	if after != nil {
+		s.AppendNodes(after)
+	}
+}
+
+func materializePseudoElement(s *goquery.Selection, styleRules []*StyleRule, scope *counterScope, minify bool) *html.Node {
+	if len(styleRules) == 0 {
+		return nil
+	}
+
+	styles := make(map[string]*StyleDeclaration)
+	mergeStyleDeclarations(styleRules, styles)
+
+	if styles["content"] == nil {
+		return nil
+	}
+
+	declarations := []*cssparser.Declaration{}
+	for _, property := range pseudoElementProperties {
+		if styles[property] != nil {
+			declarations = append(declarations, styles[property].Declaration)
+		}
+	}
+	scope.apply(declarations)
+
+	content, ok := evalContentValue(styles["content"].Declaration.Value, s, scope.counters)
+	if !ok {
+		return nil
+	}
+
+	declarations = []*cssparser.Declaration{}
+	for property, styleDecl := range styles {
+		if !slices.Contains(pseudoElementProperties, property) {
+			declarations = append(declarations, styleDecl.Declaration)
+		}
+	}
+	sort.Sort(cssparser.DeclarationsByProperty(declarations))
+
+	spanNode := &html.Node{
+		Type: html.ElementNode,
+		Data: "span",
+	}
+
+	if styleValue := computeStyleValue(declarations, minify); styleValue != "" {
+		spanNode.Attr = append(spanNode.Attr, html.Attribute{Key: "style", Val: styleValue})
+	}
+
+	if content != "" {
+		spanNode.AppendChild(&html.Node{
+			Type: html.TextNode,
+			Data: content,
+		})
+	}
+
+	return spanNode
+}
+
+// styleAttributeDeclarations returns the declarations of the style attribute of an
+// element, ignoring the ones that can't be parsed.
+func styleAttributeDeclarations(node *html.Node, parserOptions []cssparser.ParserOption) []*cssparser.Declaration {
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || attr.Key != "style" {
+			continue
+		}
+
+		styleValue, _ := extractStylePlaceholders(attr.Val)
+		declarations, _ := cssparser.ParseDeclarations(styleValue, parserOptions...)
+
+		return declarations
+	}
+
+	return nil
+}
+
+// cssCounters holds the nested instances of each CSS counter, the innermost last.
+type cssCounters map[string][]int
+
+// counterScope is the set of counters instantiated by the children of an element,
+// which go out of scope after its last child.
+type counterScope struct {
+	counters cssCounters
+	names    []string      // Names of the counters instantiated in the scope
+	parent   *counterScope // Scope of the parent element, nil for the root scope
+}
+
+// child returns the scope of the children of the element.
+func (scope *counterScope) child() *counterScope {
+	return &counterScope{counters: scope.counters, parent: scope}
+}
+
+// apply applies the `counter-reset` and `counter-increment` declarations of an element,
+// in this order.
+func (scope *counterScope) apply(declarations []*cssparser.Declaration) {
+	resets, increments := "", ""
+	for _, declaration := range declarations {
+		switch declaration.Property {
+		case "counter-reset":
+			resets = declaration.Value
+		case "counter-increment":
+			increments = declaration.Value
+		}
+	}
+
+	forEachCounter(resets, 0, scope.reset)
+	forEachCounter(increments, 1, scope.increment)
+}
+
+// reset instantiates a counter, or resets the one already instantiated in the scope.
+func (scope *counterScope) reset(name string, value int) {
+	if slices.Contains(scope.names, name) {
+		scope.counters[name][len(scope.counters[name])-1] = value
+		return
+	}
+
+	scope.counters[name] = append(scope.counters[name], value)
+	scope.names = append(scope.names, name)
+}
+
+// increment increments the innermost instance of a counter. Counters that are not in
+// scope are instantiated in the root scope.
+func (scope *counterScope) increment(name string, value int) {
+	if len(scope.counters[name]) == 0 {
+		root := scope
+		for root.parent != nil {
+			root = root.parent
+		}
+
+		root.reset(name, 0)
+	}
+
+	scope.counters[name][len(scope.counters[name])-1] += value
+}
+
+// close removes the counters instantiated in the scope.
+func (scope *counterScope) close() {
+	for _, name := range scope.names {
+		scope.counters[name] = scope.counters[name][:len(scope.counters[name])-1]
+	}
+}
+
+// forEachCounter calls f with each counter name of a `counter-reset` or
+// `counter-increment` value and its value.
+func forEachCounter(value string, defaultValue int, f func(name string, value int)) {
+	fields := strings.Fields(value)
+	for i := 0; i < len(fields); i++ {
+		name := fields[i]
+		if name == "none" {
+			continue
+		}
+
+		counterValue := defaultValue
+		if i+1 < len(fields) {
+			if number, err := strconv.Atoi(fields[i+1]); err == nil {
+				counterValue = number
+				i++
+			}
+		}
+
+		f(name, counterValue)
+	}
+}
+
+// evalContentValue evaluates the value of a `content` property, supporting strings,
+// `attr()` and `counter()` functions. When the element is nil, it only checks whether
+// the value can be evaluated.
+func evalContentValue(value string, s *goquery.Selection, counters cssCounters) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "none" || value == "normal" {
+		return "", true
+	}
+
+	result := ""
+
+	for value != "" {
+		switch {
+		case value[0] == '"' || value[0] == '\'':
+			end := skipSelectorString(value, 0)
+			if end >= len(value) {
+				return "", false
+			}
+
+			result += unescapeCssString(value[1:end])
+			value = value[end+1:]
+		case strings.HasPrefix(value, "attr(") || strings.HasPrefix(value, "counter("):
+			end := strings.IndexByte(value, ')')
+			if end < 0 {
+				return "", false
+			}
+
+			name, args, _ := strings.Cut(value[:end], "(")
+			args = strings.TrimSpace(strings.Split(args, ",")[0])
+
+			if s != nil && name == "attr" {
+				result += s.AttrOr(args, "")
+			} else if s != nil {
+				if instances := counters[args]; len(instances) > 0 {
+					result += strconv.Itoa(instances[len(instances)-1])
+				} else {
+					result += "0"
+				}
+			}
+
+			value = value[end+1:]
+		default:
+			return "", false
+		}
+
+		value = strings.TrimSpace(value)
+	}
+
+	return result, true
+}
+
+// unescapeCssString replaces the escape sequences of a CSS string.
+func unescapeCssString(value string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 >= len(value) {
+			result.WriteByte(value[i])
+			continue
+		}
+
+		// hexadecimal code point, optionally followed by a whitespace
+		end := i + 1
+		for end < len(value) && end-i <= 6 && strings.IndexByte("0123456789abcdefABCDEF", value[end]) >= 0 {
+			end++
+		}
+
+		if end == i+1 {
+			// escaped character, or escaped newline which is removed
+			i++
+			if value[i] != '\n' {
+				result.WriteByte(value[i])
+			}
+			continue
+		}
+
+		codePoint, _ := strconv.ParseInt(value[i+1:end], 16, 32)
+		result.WriteRune(rune(codePoint))
+
+		if end < len(value) && value[end] == ' ' {
+			end++
+		}
+		i = end - 1
+	}
+
+	return result.String()
+}
@@ -0,0 +1,116 @@
+package cssinliner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	cssparser "go.baoshuo.dev/cssparser"
+)
+
+// At-rules embedding rules that are removed when none of their rules are used.
+var purgeableAtRules = []string{"@media", "@supports"}
+
+// stripSelectorPseudos returns the selector without the pseudo-classes and
+// pseudo-elements matching the filter.
+func stripSelectorPseudos(selector string, filter func(pseudo selectorPseudo) bool) string {
+	result := ""
+	last := 0
+
+	for _, pseudo := range parseSelectorPseudos(selector) {
+		if !filter(pseudo) || pseudo.start < last {
+			continue
+		}
+
+		result += selector[last:pseudo.start]
+		last = pseudo.end
+
+		// keep a universal selector when the pseudo-class is not attached to another selector
+		if pseudo.start == 0 || strings.ContainsRune(" \t\n>+~(,", rune(selector[pseudo.start-1])) {
+			result += "*"
+		}
+	}
+
+	return result + selector[last:]
+}
+
+// selectorUsed returns whether the given selector, with its pseudo-classes and
+// pseudo-elements stripped, matches an element of the document. Selectors that
+// can't be evaluated are considered as used.
+func (inliner *Inliner) selectorUsed(selector string) bool {
+	selector = stripSelectorPseudos(selector, func(pseudo selectorPseudo) bool { return true })
+
+	if _, err := cascadia.Parse(matchableSelector(selector)); err != nil {
+		return true
+	}
+
+	return inliner.find(selector).Length() > 0
+}
+
+// purgeRules removes the rules whose selectors match no element of the document,
+// and the @media and @supports blocks left empty.
+func (inliner *Inliner) purgeRules(rules []fmt.Stringer) []fmt.Stringer {
+	result := []fmt.Stringer{}
+
+	for _, rule := range rules {
+		purged := inliner.purgeRule(rule)
+
+		if purged == nil {
+			inliner.report.RemovedBytes += len(inliner.ruleText(rule))
+			continue
+		}
+
+		inliner.report.RemovedBytes += len(inliner.ruleText(rule)) - len(inliner.ruleText(purged))
+		result = append(result, purged)
+	}
+
+	return result
+}
+
+// purgeRule returns the rule without its unused parts, or nil if the rule is unused.
+func (inliner *Inliner) purgeRule(rule fmt.Stringer) fmt.Stringer {
+	switch rule := rule.(type) {
+	case *StyleRule:
+		if !inliner.selectorUsed(rule.Selector) {
+			inliner.report.RemovedRules++
+			return nil
+		}
+	case *cssparser.CssRule:
+		return inliner.purgeCssRule(rule)
+	}
+
+	return rule
+}
+
+func (inliner *Inliner) purgeCssRule(rule *cssparser.CssRule) *cssparser.CssRule {
+	if rule.Kind == cssparser.QualifiedRule {
+		for _, selector := range rule.Selectors {
+			if inliner.selectorUsed(selector) {
+				return rule
+			}
+		}
+
+		inliner.report.RemovedRules++
+		return nil
+	}
+
+	if !rule.EmbedsRules() || !slices.Contains(purgeableAtRules, strings.ToLower(rule.Name)) {
+		return rule
+	}
+
+	purged := *rule
+	purged.Rules = []*cssparser.CssRule{}
+
+	for _, subRule := range rule.Rules {
+		if purgedSubRule := inliner.purgeCssRule(subRule); purgedSubRule != nil {
+			purged.Rules = append(purged.Rules, purgedSubRule)
+		}
+	}
+
+	if len(purged.Rules) == 0 {
+		return nil
+	}
+
+	return &purged
+}
@@ -0,0 +1,222 @@
+package cssinliner
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// AttributeQuote is the quote character used around attribute values.
+type AttributeQuote int
+
+const (
+	AttributeQuoteDouble AttributeQuote = iota // Attribute values are quoted with `"`
+	AttributeQuoteSingle                       // Attribute values are quoted with `'`
+)
+
+// OutputOptions controls how the output HTML document is serialized.
+type OutputOptions struct {
+	XHTML            bool           // Whether to render void elements with the XHTML self-closing syntax (e.g. `<br />`)
+	PreserveDoctype  bool           // Whether to output the doctype of the source document as is
+	PreserveEntities bool           // Whether to encode characters with the named entities used in the source document (e.g. `&nbsp;`)
+	AttributeQuote   AttributeQuote // The quote character used around attribute values
+}
+
+// needsSource returns whether the source document is required to render the output.
+func (options *OutputOptions) needsSource() bool {
+	return options != nil && (options.PreserveDoctype || options.PreserveEntities)
+}
+
+var (
+	doctypeRegexp     = regexp.MustCompile(`(?i)<!doctype[^>]*>`)
+	namedEntityRegexp = regexp.MustCompile(`&([a-zA-Z][a-zA-Z0-9]*);`)
+)
+
+// Elements without closing tag.
+var renderVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "keygen": true, "link": true, "meta": true, "param": true, "source": true,
+	"track": true, "wbr": true,
+}
+
+// Elements whose text content is not escaped.
+var rawTextElements = map[string]bool{
+	"iframe": true, "noembed": true, "noframes": true, "noscript": true, "plaintext": true,
+	"script": true, "style": true, "xmp": true,
+}
+
+// renderer serializes HTML nodes according to the output options.
+type renderer struct {
+	w        *bufio.Writer
+	options  *OutputOptions
+	doctype  string            // Doctype of the source document
+	entities map[string]string // Named entities used in the source document, by character
+	err      error
+}
+
+func newRenderer(w io.Writer, options *OutputOptions, source string) *renderer {
+	r := &renderer{
+		w:        bufio.NewWriter(w),
+		options:  options,
+		entities: make(map[string]string),
+	}
+
+	if options.PreserveDoctype {
+		r.doctype = doctypeRegexp.FindString(source)
+	}
+
+	if options.PreserveEntities {
+		for _, match := range namedEntityRegexp.FindAllStringSubmatch(source, -1) {
+			switch strings.ToLower(match[1]) {
+			case "amp", "lt", "gt", "quot", "apos":
+				continue // already escaped when needed
+			}
+
+			if char := html.UnescapeString(match[0]); char != match[0] {
+				r.entities[char] = match[0]
+			}
+		}
+	}
+
+	return r
+}
+
+func (r *renderer) write(s string) {
+	if r.err == nil {
+		_, r.err = r.w.WriteString(s)
+	}
+}
+
+// renderChildrenOf renders the children of the given node.
+func (r *renderer) renderChildrenOf(n *html.Node) error {
+	r.renderChildren(n)
+
+	if r.err != nil {
+		return r.err
+	}
+
+	return r.w.Flush()
+}
+
+func (r *renderer) renderNode(n *html.Node) {
+	switch n.Type {
+	case html.DocumentNode:
+		r.renderChildren(n)
+	case html.TextNode:
+		r.write(r.escape(n.Data, 0))
+	case html.CommentNode:
+		r.write("<!--" + n.Data + "-->")
+	case html.DoctypeNode:
+		r.renderDoctype(n)
+	case html.RawNode:
+		r.write(n.Data)
+	case html.ElementNode:
+		r.renderElement(n)
+	}
+}
+
+func (r *renderer) renderChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		r.renderNode(c)
+	}
+}
+
+func (r *renderer) renderDoctype(n *html.Node) {
+	if r.doctype != "" {
+		r.write(r.doctype)
+		return
+	}
+
+	var buf strings.Builder
+	if err := html.Render(&buf, n); err != nil {
+		r.err = err
+		return
+	}
+
+	r.write(buf.String())
+}
+
+func (r *renderer) renderElement(n *html.Node) {
+	quote := `"`
+	if r.options.AttributeQuote == AttributeQuoteSingle {
+		quote = `'`
+	}
+
+	r.write("<" + n.Data)
+	for _, attr := range n.Attr {
+		r.write(" ")
+		if attr.Namespace != "" {
+			r.write(attr.Namespace + ":")
+		}
+		r.write(attr.Key + "=" + quote + r.escape(attr.Val, quote[0]) + quote)
+	}
+
+	if renderVoidElements[n.Data] {
+		if n.FirstChild != nil {
+			r.err = errors.New("html: void element <" + n.Data + "> has child nodes")
+			return
+		}
+
+		if r.options.XHTML {
+			r.write(" />")
+		} else {
+			r.write("/>")
+		}
+		return
+	}
+
+	r.write(">")
+
+	// add initial newline where there is danger of a newline being ignored
+	if c := n.FirstChild; c != nil && c.Type == html.TextNode && strings.HasPrefix(c.Data, "\n") {
+		switch n.Data {
+		case "pre", "listing", "textarea":
+			r.write("\n")
+		}
+	}
+
+	if n.Namespace == "" && rawTextElements[n.Data] {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.TextNode {
+				r.write(c.Data)
+			} else {
+				r.renderNode(c)
+			}
+		}
+	} else {
+		r.renderChildren(n)
+	}
+
+	r.write("</" + n.Data + ">")
+}
+
+// escape escapes a text or an attribute value quoted with the given character,
+// encoding the characters of the preserved named entities.
+func (r *renderer) escape(s string, quote byte) string {
+	var result strings.Builder
+
+	for _, char := range s {
+		switch {
+		case char == '&':
+			result.WriteString("&amp;")
+		case char == '<':
+			result.WriteString("&lt;")
+		case char == '>':
+			result.WriteString("&gt;")
+		case char == '"' && quote == '"':
+			result.WriteString("&#34;")
+		case char == '\'' && quote == '\'':
+			result.WriteString("&#39;")
+		case r.entities[string(char)] != "":
+			result.WriteString(r.entities[string(char)])
+		default:
+			result.WriteRune(char)
+		}
+	}
+
+	return result.String()
+}
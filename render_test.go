@@ -0,0 +1,52 @@
+package cssinliner
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestInlineWithOutputOptions(t *testing.T) {
+	source := `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">
+<html><head><style>p { font-family: "Arial"; }</style></head><body><!--[if mso]><table><tr><td><![endif]--><p title="It's">A&nbsp;B &copy; 2025 &amp; "C"<br>D</p><img src="a.png" alt=""></body></html>`
+	expected := `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd"><html><head></head><body><!--[if mso]><table><tr><td><![endif]--><p title='It&#39;s' style='font-family: "Arial";'>A&nbsp;B &copy; 2025 &amp; "C"<br />D</p><img src='a.png' alt='' /></body></html>`
+
+	result, err := Inline(source, WithOutputOptions(OutputOptions{
+		XHTML:            true,
+		PreserveDoctype:  true,
+		PreserveEntities: true,
+		AttributeQuote:   AttributeQuoteSingle,
+	}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestRenderVoidElementWithChildren(t *testing.T) {
+	br := &html.Node{Type: html.ElementNode, Data: "br"}
+	br.AppendChild(&html.Node{Type: html.TextNode, Data: "Child"})
+
+	root := &html.Node{Type: html.DocumentNode}
+	root.AppendChild(br)
+
+	var result strings.Builder
+	if err := newRenderer(&result, &OutputOptions{}, "").renderChildrenOf(root); err == nil {
+		t.Errorf("Expected an error for a void element with children, got %s", result.String())
+	}
+}
+
+func TestInlineNodeWithSourceOutputOptions(t *testing.T) {
+	node, err := html.Parse(strings.NewReader(`<html><head></head><body><p>Hello</p></body></html>`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := InlineNode(node, WithOutputOptions(OutputOptions{PreserveDoctype: true})); err == nil {
+		t.Errorf("Expected an error for the PreserveDoctype output option")
+	}
+}
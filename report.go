@@ -0,0 +1,33 @@
+package cssinliner
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Report contains information collected while inlining a document.
+type Report struct {
+	RemovedRules int          `json:"removedRules"`          // Number of unused CSS rules removed from the output stylesheets
+	RemovedBytes int          `json:"removedBytes"`          // Number of bytes saved by removing unused CSS rules
+	Diagnostics  []Diagnostic `json:"diagnostics,omitempty"` // Problems that didn't prevent inlining, such as stylesheets failing to load
+	LocalFiles   []string     `json:"localFiles,omitempty"`  // Local stylesheet files resolved while inlining, including the imported ones
+}
+
+// Diagnostic describes a problem that didn't prevent inlining.
+type Diagnostic struct {
+	Source  string `json:"source"`  // The stylesheet URL or path the problem relates to
+	Message string `json:"message"` // Description of the problem
+}
+
+func (report *Report) addDiagnostic(source string, format string, args ...any) {
+	report.Diagnostics = append(report.Diagnostics, Diagnostic{
+		Source:  source,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (report *Report) addLocalFile(path string) {
+	if !slices.Contains(report.LocalFiles, path) {
+		report.LocalFiles = append(report.LocalFiles, path)
+	}
+}
@@ -0,0 +1,203 @@
+package cssinliner
+
+import (
+	"slices"
+	"strings"
+)
+
+// Pseudo-classes taking a selector list as argument.
+var selectorListPseudoClasses = []string{"not", "has", "haschild", "is", "where"}
+
+// Pseudo-classes taking a selector list as argument and matching its elements, which
+// are not supported by the "github.com/andybalholm/cascadia" package.
+var matchesAnyPseudoClasses = []string{"is", "where"}
+
+// Pseudo-elements that can be written with the legacy single colon syntax.
+var legacyPseudoElements = []string{"after", "before", "first-letter", "first-line"}
+
+// selectorPseudo is a pseudo-class or a pseudo-element found in a selector.
+type selectorPseudo struct {
+	name    string // Lower-cased name, without colons
+	element bool   // Whether it's a pseudo-element
+	start   int    // Offset of the first colon in the selector
+	end     int    // Offset following the name or the closing parenthesis
+}
+
+// parseSelectorPseudos returns the pseudo-classes and pseudo-elements of a selector,
+// including the ones nested in selector list arguments (e.g. `:not(:hover)`).
+//
+// Escaped characters, strings and attribute selectors are skipped, so that selectors
+// like `.hover\:underline` or `[data-x=":hover"]` are not considered as using pseudo-classes.
+func parseSelectorPseudos(selector string) []selectorPseudo {
+	return parseSelectorPseudosAt(selector, 0)
+}
+
+func parseSelectorPseudosAt(selector string, offset int) []selectorPseudo {
+	result := []selectorPseudo{}
+
+	for i := 0; i < len(selector); i++ {
+		switch selector[i] {
+		case '\\':
+			i++ // skip escaped character
+		case '"', '\'':
+			i = skipSelectorString(selector, i)
+		case '[':
+			i = skipSelectorBlock(selector, i, '[', ']')
+		case ':':
+			pseudo := selectorPseudo{start: offset + i}
+
+			i++
+			if i < len(selector) && selector[i] == ':' {
+				pseudo.element = true
+				i++
+			}
+
+			nameStart := i
+			for i < len(selector) && isSelectorNameChar(selector[i]) {
+				if selector[i] == '\\' {
+					i++
+				}
+				i++
+			}
+
+			pseudo.name = strings.ToLower(selector[nameStart:min(i, len(selector))])
+			pseudo.element = pseudo.element || slices.Contains(legacyPseudoElements, pseudo.name)
+
+			nested := []selectorPseudo{}
+			if i < len(selector) && selector[i] == '(' {
+				end := skipSelectorBlock(selector, i, '(', ')')
+				if slices.Contains(selectorListPseudoClasses, pseudo.name) {
+					nested = parseSelectorPseudosAt(selector[i+1:min(end, len(selector))], offset+i+1)
+				}
+				i = end + 1
+			}
+
+			pseudo.end = offset + min(i, len(selector))
+			result = append(result, pseudo)
+			result = append(result, nested...)
+
+			i-- // compensate the loop increment
+		}
+	}
+
+	return result
+}
+
+func isSelectorNameChar(c byte) bool {
+	return c == '-' || c == '_' || c == '\\' || c >= 0x80 ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// skipSelectorString returns the offset of the quote closing the string starting at i.
+func skipSelectorString(selector string, i int) int {
+	quote := selector[i]
+
+	for i++; i < len(selector); i++ {
+		if selector[i] == '\\' {
+			i++
+		} else if selector[i] == quote {
+			return i
+		}
+	}
+
+	return len(selector)
+}
+
+// skipSelectorBlock returns the offset of the character closing the block starting at i.
+func skipSelectorBlock(selector string, i int, open, close byte) int {
+	depth := 0
+
+	for ; i < len(selector); i++ {
+		switch selector[i] {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipSelectorString(selector, i)
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(selector)
+}
+
+// splitSelectorList splits a selector list on its top-level commas.
+func splitSelectorList(selectorList string) []string {
+	result := []string{}
+	last := 0
+
+	for i := 0; i < len(selectorList); i++ {
+		switch selectorList[i] {
+		case '\\':
+			i++
+		case '"', '\'':
+			i = skipSelectorString(selectorList, i)
+		case '[':
+			i = skipSelectorBlock(selectorList, i, '[', ']')
+		case '(':
+			i = skipSelectorBlock(selectorList, i, '(', ')')
+		case ',':
+			result = append(result, strings.TrimSpace(selectorList[last:i]))
+			last = i + 1
+		}
+	}
+
+	return append(result, strings.TrimSpace(selectorList[min(last, len(selectorList)):]))
+}
+
+// nextMatchesAnyPseudoClass returns the first `:is()` or `:where()` pseudo-class of
+// a selector, along with its selector list argument.
+func nextMatchesAnyPseudoClass(selector string) (selectorPseudo, string, bool) {
+	for _, pseudo := range parseSelectorPseudos(selector) {
+		if pseudo.element || !slices.Contains(matchesAnyPseudoClasses, pseudo.name) || selector[pseudo.end-1] != ')' {
+			continue
+		}
+
+		open := pseudo.start + strings.IndexByte(selector[pseudo.start:], '(')
+
+		return pseudo, selector[open+1 : pseudo.end-1], true
+	}
+
+	return selectorPseudo{}, "", false
+}
+
+// matchableSelector returns the selector with its `:is()` and `:where()` pseudo-classes
+// rewritten as the equivalent `:not(:not())`, so that it can be matched by cascadia.
+func matchableSelector(selector string) string {
+	for {
+		pseudo, selectorList, ok := nextMatchesAnyPseudoClass(selector)
+		if !ok {
+			return selector
+		}
+
+		selector = selector[:pseudo.start] + ":not(:not(" + selectorList + "))" + selector[pseudo.end:]
+	}
+}
+
+// specificSelector returns the selector with its `:where()` pseudo-classes removed and
+// its `:is()` pseudo-classes replaced with their most specific argument, as they add
+// no specificity of their own.
+func specificSelector(selector string) string {
+	for {
+		pseudo, selectorList, ok := nextMatchesAnyPseudoClass(selector)
+		if !ok {
+			return selector
+		}
+
+		replacement := ""
+		if pseudo.name == "is" {
+			for _, argument := range splitSelectorList(selectorList) {
+				if replacement == "" || ComputeSpecificity(argument) > ComputeSpecificity(replacement) {
+					replacement = argument
+				}
+			}
+		}
+
+		selector = selector[:pseudo.start] + replacement + selector[pseudo.end:]
+	}
+}
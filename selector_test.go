@@ -0,0 +1,64 @@
+package cssinliner
+
+import "testing"
+
+func TestInlinable(t *testing.T) {
+	cases := map[string]bool{
+		"p":                       true,
+		"ul li:first-child":       true,
+		"tr:nth-of-type(2n+1) td": true,
+		".hover\\:underline":      true,
+		`[data-x=":hover"]`:       true,
+		"a:not(.active)":          true,
+		":root":                   true,
+		":is(h1, h2) a":           true,
+		"p:where(.intro, #lead)":  true,
+		"a:link":                  false,
+		"input:checked":           false,
+		":is(a:hover, p)":         false,
+		"a:hover":                 false,
+		"a:not(:focus)":           false,
+		"p::before":               false,
+		"p:after":                 false,
+		"input::placeholder":      false,
+		"a:focus-within":          false,
+		"p:unknown-pseudo":        false,
+		"div >":                   false,
+	}
+
+	for selector, expected := range cases {
+		if result := Inlinable(selector); result != expected {
+			t.Errorf("Inlinable(%q): expected %v, got %v", selector, expected, result)
+		}
+	}
+}
+
+func TestStripDynamicPseudoClasses(t *testing.T) {
+	cases := map[string]string{
+		"a:hover":                  "a",
+		".btn:hover span":          ".btn span",
+		":focus":                   "*",
+		"ul :hover > a:visited":    "ul * > a",
+		".hover\\:underline:hover": ".hover\\:underline",
+	}
+
+	for selector, expected := range cases {
+		if result := stripDynamicPseudoClasses(selector); result != expected {
+			t.Errorf("stripDynamicPseudoClasses(%q): expected %q, got %q", selector, expected, result)
+		}
+	}
+}
+
+func TestComputeSpecificityOfMatchesAnyPseudoClasses(t *testing.T) {
+	cases := map[string]int{
+		":is(h1, #title) a":  101,
+		"p:where(.a, #b)":    1,
+		":where(#main) .btn": 10,
+	}
+
+	for selector, expected := range cases {
+		if result := ComputeSpecificity(selector); result != expected {
+			t.Errorf("ComputeSpecificity(%q): expected %d, got %d", selector, expected, result)
+		}
+	}
+}
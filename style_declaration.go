@@ -4,9 +4,10 @@ import (
 	cssparser "go.baoshuo.dev/cssparser"
 )
 
+// StyleDeclaration is a declaration along with the style rule it comes from.
 type StyleDeclaration struct {
-	StyleRule   *StyleRule
-	Declaration *cssparser.Declaration
+	StyleRule   *StyleRule             // The style rule the declaration comes from
+	Declaration *cssparser.Declaration // The declaration
 }
 
 func NewStyleDeclaration(styleRule *StyleRule, declaration *cssparser.Declaration) *StyleDeclaration {
@@ -16,10 +17,26 @@ func NewStyleDeclaration(styleRule *StyleRule, declaration *cssparser.Declaratio
 	}
 }
 
+// Inline returns whether the declaration comes from the `style` attribute of the element.
+func (styleDecl *StyleDeclaration) Inline() bool {
+	return styleDecl.StyleRule != nil && styleDecl.StyleRule.Selector == inlineFakeSelector
+}
+
+// Attribute returns whether the declaration comes from a presentational attribute of the
+// element (e.g. `bgcolor`).
+func (styleDecl *StyleDeclaration) Attribute() bool {
+	return styleDecl.StyleRule != nil && styleDecl.StyleRule.Selector == attributeFakeSelector
+}
+
+// Specificity returns the specificity of the declaration, 0 if it has no style rule.
 func (styleDecl *StyleDeclaration) Specificity() int {
 	if styleDecl.Declaration.Important {
 		return 10000
 	}
 
+	if styleDecl.StyleRule == nil {
+		return 0
+	}
+
 	return styleDecl.StyleRule.Specificity
 }
@@ -8,7 +8,8 @@ import (
 )
 
 const (
-	inlineFakeSelector = "*INLINE*"
+	inlineFakeSelector    = "*INLINE*"
+	attributeFakeSelector = "*ATTRIBUTE*"
 
 	cssIdentifierRegexp = `-?([_a-zA-Z]|[\x{00A0}-\x{FFFF}]|(\\[^\r\n\f0-9a-fA-F]))([_a-zA-Z0-9-]|[\x{00A0}-\x{FFFF}]|(\\[^\r\n\f0-9a-fA-F]))*`
 )
@@ -34,6 +35,7 @@ type StyleRule struct {
 	Selector     string                   // The style rule selector
 	Declarations []*cssparser.Declaration // The style rule properties
 	Specificity  int                      // Selector specificity
+	Source       *CssSource               // Where the rule comes from, nil if unknown
 }
 
 func NewStyleRule(selector string, declarations []*cssparser.Declaration) *StyleRule {
@@ -70,10 +72,12 @@ func (styleRule *StyleRule) String() string {
 func ComputeSpecificity(selector string) int {
 	result := 0
 
-	if selector == inlineFakeSelector {
+	if selector == inlineFakeSelector || selector == attributeFakeSelector {
 		result += 1000
 	}
 
+	selector = specificSelector(selector)
+
 	idSelectors := idSelectorRegexp.FindAllStringSubmatch(selector, -1)
 	selector = idSelectorRegexp.ReplaceAllString(selector, "")
 
@@ -0,0 +1,264 @@
+package cssinliner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	cssparser "go.baoshuo.dev/cssparser"
+	"golang.org/x/net/html"
+)
+
+// Attributes of a <link> element that are not carried over to the <style> element
+// replacing it.
+var linkOnlyAttributes = []string{"rel", "href", "as", "crossorigin", "integrity", "referrerpolicy"}
+
+// StylesheetPosition is the position of programmatically supplied stylesheets in
+// the cascade, relatively to the stylesheets of the document.
+type StylesheetPosition int
+
+const (
+	BeforeDocumentStyles StylesheetPosition = iota // Applied before the stylesheets of the document, which override them
+	AfterDocumentStyles                            // Applied after the stylesheets of the document, overriding them
+)
+
+// extraStylesheet is a stylesheet supplied programmatically, either as CSS or compiled.
+type extraStylesheet struct {
+	position   StylesheetPosition
+	css        string                // CSS to parse, if not compiled
+	stylesheet *cssparser.Stylesheet // Compiled stylesheet
+}
+
+// styleSheet is a stylesheet parsed from a <style> element of the document, or
+// supplied programmatically.
+type styleSheet struct {
+	stylesheet *cssparser.Stylesheet // Parsed CSS stylesheet
+	element    *goquery.Selection    // The <style> element the stylesheet was read from, nil if supplied programmatically
+	rawRules   []fmt.Stringer        // CSS rules that are not inlinable but that must be inserted in output document
+	keep       bool                  // Whether the <style> element is kept as is in the output document
+	position   StylesheetPosition    // Position of a programmatically supplied stylesheet
+	source     *CssSource            // Where the stylesheet comes from
+	positions  []cssPosition         // Positions of the top-level rules in the CSS text, nil if unknown
+}
+
+// cssPosition is a position in a CSS text, starting at line 1 and column 1.
+type cssPosition struct {
+	line   int
+	column int
+}
+
+func newStyleSheet(stylesheet *cssparser.Stylesheet, element *goquery.Selection) *styleSheet {
+	return &styleSheet{
+		stylesheet: stylesheet,
+		element:    element,
+	}
+}
+
+// locateRules records the positions of the top-level rules of the stylesheet, found
+// in its source before preprocessing. Positions are left unknown if the rules found in
+// the source don't match the parsed ones.
+func (sheet *styleSheet) locateRules(positions []cssPosition) {
+	if len(positions) != len(sheet.stylesheet.Rules) {
+		return
+	}
+
+	sheet.positions = positions
+}
+
+// styleElementRulePositions returns the positions in an HTML document of the top-level
+// rules of each of its <style> elements, in document order.
+func styleElementRulePositions(document string) [][]cssPosition {
+	result := [][]cssPosition{}
+	position := cssPosition{line: 1, column: 1}
+	inStyle := false
+
+	z := html.NewTokenizer(strings.NewReader(document))
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		raw := string(z.Raw())
+		name, _ := z.TagName()
+
+		switch {
+		case tokenType == html.StartTagToken && string(name) == "style":
+			inStyle = true
+			result = append(result, []cssPosition{})
+		case tokenType == html.TextToken && inStyle:
+			for _, rulePosition := range findRulePositions(raw) {
+				if rulePosition.line == 1 {
+					rulePosition.column += position.column - 1
+				}
+				rulePosition.line += position.line - 1
+
+				result[len(result)-1] = append(result[len(result)-1], rulePosition)
+			}
+		default:
+			inStyle = false
+		}
+
+		position = advancePosition(position, raw)
+	}
+
+	return result
+}
+
+// ruleSource returns the source of the top-level rule at the given index.
+func (sheet *styleSheet) ruleSource(index int) *CssSource {
+	if sheet.source == nil || index >= len(sheet.positions) {
+		return sheet.source
+	}
+
+	source := *sheet.source
+	source.Line = sheet.positions[index].line
+	source.Column = sheet.positions[index].column
+
+	return &source
+}
+
+// newSourcedStyleRule creates a style rule coming from the given source.
+func newSourcedStyleRule(selector string, declarations []*cssparser.Declaration, source *CssSource) *StyleRule {
+	styleRule := NewStyleRule(selector, declarations)
+	styleRule.Source = source
+
+	return styleRule
+}
+
+// findRulePositions returns the positions of the top-level rules and at-rules of a
+// CSS text, skipping comments and strings.
+func findRulePositions(css string) []cssPosition {
+	positions := []cssPosition{}
+	position := cssPosition{line: 1, column: 1}
+	depth := 0
+	inRule := false
+
+	for i := 0; i < len(css); {
+		c := css[i]
+
+		switch {
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				end = len(css)
+			} else {
+				end += i + 4
+			}
+			position = advancePosition(position, css[i:end])
+			i = end
+			continue
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(css) && css[end] != c && css[end] != '\n' {
+				if css[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(css))
+			position = advancePosition(position, css[i:end])
+			i = end
+			continue
+		case !inRule && depth == 0 && !isCssWhitespace(c):
+			if c == ';' || c == '}' {
+				// stray delimiter, not a rule
+				break
+			}
+			positions = append(positions, position)
+			inRule = true
+		}
+
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 {
+				inRule = false
+			}
+		case ';':
+			if depth == 0 {
+				inRule = false
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(css[i:])
+		position = advancePosition(position, css[i:i+size])
+		i += size
+	}
+
+	return positions
+}
+
+// advancePosition returns the position following the given text.
+func advancePosition(position cssPosition, text string) cssPosition {
+	for _, r := range text {
+		if r == '\n' {
+			position.line++
+			position.column = 1
+		} else {
+			position.column++
+		}
+	}
+
+	return position
+}
+
+func isCssWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func (sheet *styleSheet) addRawRule(rule fmt.Stringer) {
+	// kept stylesheets already hold all of their rules
+	if sheet.keep {
+		return
+	}
+
+	sheet.rawRules = append(sheet.rawRules, rule)
+}
+
+// newStyleNode creates a <style> element containing the given CSS.
+func newStyleNode(css string, attrs []html.Attribute) *html.Node {
+	styleNode := &html.Node{
+		Type: html.ElementNode,
+		Data: "style",
+		Attr: attrs,
+	}
+
+	styleNode.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: css,
+	})
+
+	return styleNode
+}
+
+// setStyleText replaces the content of a <style> element. The CSS is not escaped,
+// as the content of <style> elements is raw text.
+func setStyleText(element *goquery.Selection, css string) {
+	element.Empty()
+	element.AppendNodes(&html.Node{
+		Type: html.TextNode,
+		Data: css,
+	})
+}
+
+// newLinkedStyleNode creates a <style> element replacing a <link rel="stylesheet">
+// element, keeping the attributes that still make sense on a <style> element
+// (e.g. `media`, `nonce` or `id`).
+func newLinkedStyleNode(css string, link *goquery.Selection) *html.Node {
+	attrs := []html.Attribute{}
+
+	for _, attr := range link.Nodes[0].Attr {
+		if attr.Namespace == "" && !slices.Contains(linkOnlyAttributes, attr.Key) {
+			attrs = append(attrs, attr)
+		}
+	}
+
+	return newStyleNode(css, attrs)
+}
@@ -0,0 +1,135 @@
+package cssinliner
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"text/template/parse"
+)
+
+// ParseTemplate inlines the CSS styles into the template source, with its actions
+// protected as placeholders, and parses the result as the body of t.
+//
+// This allows paying the inlining cost once per template, rather than once per execution.
+//
+// NOTE: When t uses custom delimiters (set with `Delims`), they must be given with
+// WithPlaceholders, as they can't be read from t.
+func ParseTemplate(t *template.Template, source string, options ...InlinerOption) (*template.Template, error) {
+	defaultDelims, err := hasDefaultDelims(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if defaultDelims {
+		options = append([]InlinerOption{WithPlaceholders(GoTemplateDelimiters)}, options...)
+	}
+
+	inliner := NewInliner(source, options...)
+	if inliner.placeholders == nil {
+		return nil, fmt.Errorf("template %s uses custom delimiters, which must be given with WithPlaceholders", t.Name())
+	}
+
+	inlined, err := inliner.Inline()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inline template %s: %w", t.Name(), err)
+	}
+
+	return t.Parse(inlined)
+}
+
+// hasDefaultDelims returns whether the template parses actions with the default delimiters.
+func hasDefaultDelims(t *template.Template) (bool, error) {
+	probe, err := t.Clone()
+	if err != nil {
+		return false, err
+	}
+
+	probe, err = probe.New("").Parse("{{.}}")
+	if err != nil {
+		return false, err
+	}
+
+	nodes := probe.Tree.Root.Nodes
+	_, ok := nodes[0].(*parse.ActionNode)
+
+	return len(nodes) == 1 && ok, nil
+}
+
+// InlineTemplate returns a copy of an already parsed template, with the CSS styles
+// inlined into its body. The associated templates (e.g. declared with `{{define}}`)
+// are kept as is, as they usually are fragments of the document.
+//
+// NOTE: The template must not have been executed, and comments in its actions are lost.
+// The body is re-parsed with the default delimiters, which the returned template uses.
+func InlineTemplate(t *template.Template, options ...InlinerOption) (*template.Template, error) {
+	if t.Tree == nil || t.Tree.Root == nil {
+		return nil, fmt.Errorf("template %s is not parsed", t.Name())
+	}
+
+	result, err := t.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	var source strings.Builder
+	writeTemplateNode(&source, t.Tree.Root)
+
+	return ParseTemplate(result.Delims("", ""), source.String(), options...)
+}
+
+// writeTemplateNode writes the source of a parsed template node with the default
+// delimiters, whatever the delimiters it was parsed with.
+func writeTemplateNode(sb *strings.Builder, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, child := range node.Nodes {
+			writeTemplateNode(sb, child)
+		}
+	case *parse.TextNode:
+		sb.WriteString(escapeTemplateText(string(node.Text)))
+	case *parse.ActionNode:
+		sb.WriteString("{{" + node.Pipe.String() + "}}")
+	case *parse.IfNode:
+		writeTemplateBranch(sb, "if", &node.BranchNode)
+	case *parse.RangeNode:
+		writeTemplateBranch(sb, "range", &node.BranchNode)
+	case *parse.WithNode:
+		writeTemplateBranch(sb, "with", &node.BranchNode)
+	case *parse.TemplateNode:
+		sb.WriteString(fmt.Sprintf("{{template %q", node.Name))
+		if node.Pipe != nil {
+			sb.WriteString(" " + node.Pipe.String())
+		}
+		sb.WriteString("}}")
+	case *parse.BreakNode:
+		sb.WriteString("{{break}}")
+	case *parse.ContinueNode:
+		sb.WriteString("{{continue}}")
+	case *parse.CommentNode:
+		sb.WriteString("{{" + node.Text + "}}")
+	}
+}
+
+func writeTemplateBranch(sb *strings.Builder, name string, branch *parse.BranchNode) {
+	sb.WriteString("{{" + name + " " + branch.Pipe.String() + "}}")
+	writeTemplateNode(sb, branch.List)
+
+	if branch.ElseList != nil {
+		sb.WriteString("{{else}}")
+		writeTemplateNode(sb, branch.ElseList)
+	}
+
+	sb.WriteString("{{end}}")
+}
+
+// escapeTemplateText escapes the default opening delimiters found in template text,
+// including a trailing brace that would be merged with a following action.
+func escapeTemplateText(text string) string {
+	text = strings.ReplaceAll(text, "{{", `{{"{{"}}`)
+
+	if strings.HasSuffix(text, "{") && !strings.HasSuffix(text, "}}") {
+		text = strings.TrimSuffix(text, "{") + `{{"{"}}`
+	}
+
+	return text
+}
@@ -0,0 +1,116 @@
+package cssinliner
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+)
+
+const templateSource = `<html><head><style>p { color: {{ .Color }}; }</style></head><body><p>Hello {{ .Name }}</p><a href="{{ .URL }}">Link</a></body></html>`
+
+var templateData = map[string]string{"Color": "red", "Name": "<World>", "URL": "https://example.com/?a=1&b=2"}
+
+const templateExpected = `<html><head></head><body><p style="color: red;">Hello &lt;World&gt;</p><a href="https://example.com/?a=1&amp;b=2">Link</a></body></html>`
+
+func TestParseTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate(template.New("email"), templateSource)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, templateData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != templateExpected {
+		t.Errorf("Expected %s, got %s", templateExpected, result.String())
+	}
+}
+
+func TestInlineTemplate(t *testing.T) {
+	source, err := template.New("email").Parse(templateSource)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tmpl, err := InlineTemplate(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, templateData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != templateExpected {
+		t.Errorf("Expected %s, got %s", templateExpected, result.String())
+	}
+}
+
+func TestInlineTemplateWithCustomDelimiters(t *testing.T) {
+	source, err := template.New("email").Delims("[[", "]]").Parse(`<html><head><style>p { color: [[ .Color ]]; }</style></head><body><p>{{ not an action }} [[ if .Name ]]Hello [[ .Name ]]{[[ end ]]</p></body></html>`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tmpl, err := InlineTemplate(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, templateData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `<html><head></head><body><p style="color: red;">{{ not an action }} Hello &lt;World&gt;{</p></body></html>`
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+}
+
+func TestInlineTemplateWithTableRange(t *testing.T) {
+	source, err := template.New("email").Parse(`<html><head><style>td { padding: 4px; }</style></head><body><table>{{ range .Rows }}<tr><td>{{ . }}</td></tr>{{ end }}</table></body></html>`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tmpl, err := InlineTemplate(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, map[string][]string{"Rows": {"A", "B"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := `<html><head></head><body><table><tbody><tr><td style="padding: 4px;">A</td></tr><tbody><tr><td style="padding: 4px;">B</td></tr></tbody></table></body></html>`
+	if result.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, result.String())
+	}
+}
+
+func TestParseTemplateWithCustomDelimiters(t *testing.T) {
+	source := strings.NewReplacer("{{", "[[", "}}", "]]").Replace(templateSource)
+
+	if _, err := ParseTemplate(template.New("email").Delims("[[", "]]"), source); err == nil {
+		t.Errorf("Expected an error for custom delimiters without placeholders")
+	}
+
+	tmpl, err := ParseTemplate(template.New("email").Delims("[[", "]]"), source, WithPlaceholders(Delimiters{Open: "[[", Close: "]]"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result strings.Builder
+	if err := tmpl.Execute(&result, templateData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if result.String() != templateExpected {
+		t.Errorf("Expected %s, got %s", templateExpected, result.String())
+	}
+}
@@ -0,0 +1,65 @@
+package cssinliner
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// referencedNames returns the class and id names referenced by the <style> elements
+// left in the document.
+func (inliner *Inliner) referencedNames() (classes map[string]bool, ids map[string]bool) {
+	classes = make(map[string]bool)
+	ids = make(map[string]bool)
+
+	inliner.doc.Find("style").Each(func(i int, s *goquery.Selection) {
+		css := s.Text()
+
+		for _, match := range classSelectorRegExp.FindAllString(css, -1) {
+			classes[unescapeCssString(match[1:])] = true
+		}
+
+		for _, match := range idSelectorRegexp.FindAllString(css, -1) {
+			ids[unescapeCssString(match[1:])] = true
+		}
+	})
+
+	return classes, ids
+}
+
+// stripUnusedClassesAndIDs removes the `class` and `id` attribute values that are not
+// referenced by the <style> elements left in the document, nor allowed explicitly.
+// The values holding template placeholders are kept, as they can't be resolved.
+func (inliner *Inliner) stripUnusedClassesAndIDs() {
+	if !inliner.removeUnusedClassesAndIDs {
+		return
+	}
+
+	classes, ids := inliner.referencedNames()
+	used := func(names map[string]bool, name string) bool {
+		return names[name] || slices.Contains(inliner.keptClassesAndIDs, name) || strings.Contains(name, placeholderTokenPrefix)
+	}
+
+	inliner.find("[class]").Each(func(i int, s *goquery.Selection) {
+		if inlinerDirective(s) == inlinerIgnore {
+			return
+		}
+
+		kept := slices.DeleteFunc(strings.Fields(s.AttrOr("class", "")), func(class string) bool {
+			return !used(classes, class)
+		})
+
+		if len(kept) == 0 {
+			s.RemoveAttr("class")
+		} else {
+			s.SetAttr("class", strings.Join(kept, " "))
+		}
+	})
+
+	inliner.find("[id]").Each(func(i int, s *goquery.Selection) {
+		if inlinerDirective(s) != inlinerIgnore && !used(ids, s.AttrOr("id", "")) {
+			s.RemoveAttr("id")
+		}
+	})
+}
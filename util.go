@@ -1,26 +1,37 @@
 package cssinliner
 
 import (
+	"slices"
 	"strings"
 
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
 	cssparser "go.baoshuo.dev/cssparser"
 )
 
-// TODO: Get list of supported pseudo selectors from "github.com/andybalholm/cascadia" package
-// https://github.com/andybalholm/cascadia/blob/5263deb988702df34b4de5b8cd2fe53add4bea3d/parser.go#L473-L607
-
-var unsupportedSelectors = []string{
-	":active", ":after", ":before", ":checked", ":disabled", ":enabled",
-	":first-line", ":first-letter", ":focus", ":hover", ":invalid", ":in-range",
-	":lang", ":link", ":root", ":selection", ":target", ":valid", ":visited"}
+// Pseudo-classes supported by the "github.com/andybalholm/cascadia" package that
+// depend neither on user interaction nor on the state of elements (e.g. `:link`,
+// `:checked`), so they can be matched when inlining. `:is()` and `:where()` are
+// rewritten into selectors supported by cascadia.
+//
+// cf. https://github.com/andybalholm/cascadia/blob/v1.3.3/parser.go#L480-L607
+var inlinablePseudoClasses = []string{
+	"not", "has", "haschild", "contains", "containsown", "matches", "matchesown", "is", "where",
+	"nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type",
+	"first-child", "last-child", "first-of-type", "last-of-type", "only-child", "only-of-type",
+	"input", "empty",
+	"root", // matches the <html> element, so that custom properties are inherited by the document
+}
 
+// Inlinable returns whether the rules of the given selector can be inlined, that is
+// whether the selector can be matched against the elements of a static document.
 func Inlinable(selector string) bool {
-	if strings.Contains(selector, "::") {
+	if _, err := cascadia.Parse(matchableSelector(selector)); err != nil {
 		return false
 	}
 
-	for _, badSel := range unsupportedSelectors {
-		if strings.Contains(selector, badSel) {
+	for _, pseudo := range parseSelectorPseudos(selector) {
+		if pseudo.element || !slices.Contains(inlinablePseudoClasses, pseudo.name) {
 			return false
 		}
 	}
@@ -28,7 +39,18 @@ func Inlinable(selector string) bool {
 	return true
 }
 
-func computeStyleValue(declarations []*cssparser.Declaration) string {
+// inlinerDirective returns the value of the `data-inliner` attribute of an element.
+func inlinerDirective(s *goquery.Selection) string {
+	value, _ := s.Attr(inlinerAttr)
+
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func computeStyleValue(declarations []*cssparser.Declaration, minify bool) string {
+	if minify {
+		return minifyDeclarations(declarations, false)
+	}
+
 	result := ""
 
 	// set style attribute value